@@ -3,11 +3,20 @@ package Init
 import (
 	"github.com/hewo233/house-system-backend/db"
 	"github.com/hewo233/house-system-backend/utils/OSS"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"github.com/hewo233/house-system-backend/utils/geo"
 	"github.com/hewo233/house-system-backend/utils/jwt"
+	"github.com/hewo233/house-system-backend/utils/notify"
+	"github.com/hewo233/house-system-backend/utils/search"
 )
 
 func AllInit() {
 	db.Init()
 	OSS.Init()
 	jwt.InitJWTKey()
+	notify.Init()
+	division.Init()
+	search.DistrictName = division.FullName
+	search.Init()
+	geo.Init()
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"log"
+)
+
+// 记录房源创建者之前录入的房源 user_id 为 0, 只有管理员可以修改, 把它们归属到指定的经纪人
+// usage: go run ./cmd/backfill-owner -phone 13800000000 [-dry-run]
+func main() {
+	phone := flag.String("phone", "", "phone of the agent who will own legacy properties")
+	dryRun := flag.Bool("dry-run", false, "only print how many properties would be updated")
+	flag.Parse()
+
+	if len(*phone) != 11 {
+		log.Fatal("phone must be 11 digits")
+	}
+
+	db.Init()
+
+	user := models.NewUser()
+	result := db.DB.Table(consts.UserTable).Where("phone = ?", *phone).Limit(1).Find(user)
+	if result.Error != nil {
+		log.Fatal("failed to query database: ", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Fatal("user not found: ", *phone)
+	}
+
+	// 已删除的房源也一起归属, 保持数据一致
+	query := db.DB.Table(consts.PropertyTable).Where("user_id = 0 OR user_id IS NULL")
+
+	if *dryRun {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Fatal("failed to count properties: ", err)
+		}
+		log.Printf("%d properties have no owner\n", count)
+		return
+	}
+
+	result = query.Update("user_id", user.ID)
+	if result.Error != nil {
+		log.Fatal("failed to backfill properties: ", result.Error)
+	}
+
+	log.Printf("\033[32massigned %d properties to %s\033[0m\n", result.RowsAffected, user.Phone)
+}
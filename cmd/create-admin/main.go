@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/password"
+	"log"
+)
+
+// 创建第一个管理员, 或者把已有用户提升为管理员
+// usage: go run ./cmd/create-admin -phone 13800000000 -username admin -password xxxxxx
+func main() {
+	phone := flag.String("phone", "", "admin phone, 11 digits")
+	username := flag.String("username", "", "admin username, required when creating a new user")
+	pass := flag.String("password", "", "admin password, at least 6 characters")
+	flag.Parse()
+
+	if len(*phone) != 11 {
+		log.Fatal("phone must be 11 digits")
+	}
+
+	db.Init()
+
+	user := models.NewUser()
+	result := db.DB.Table(consts.UserTable).Where("phone = ?", *phone).Limit(1).Find(user)
+	if result.Error != nil {
+		log.Fatal("failed to query database: ", result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		updates := map[string]interface{}{"role": consts.Admin}
+		if *pass != "" {
+			if len(*pass) < 6 {
+				log.Fatal("password must be at least 6 characters long")
+			}
+			hashedPassword, err := password.HashPassword(*pass)
+			if err != nil {
+				log.Fatal("failed to hash password: ", err)
+			}
+			updates["password"] = hashedPassword
+		}
+
+		if err := db.DB.Table(consts.UserTable).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			log.Fatal("failed to promote user: ", err)
+		}
+		log.Printf("\033[32muser %s is admin now\033[0m\n", *phone)
+		return
+	}
+
+	if *username == "" || len(*pass) < 6 {
+		log.Fatal("username is required and password must be at least 6 characters long")
+	}
+
+	hashedPassword, err := password.HashPassword(*pass)
+	if err != nil {
+		log.Fatal("failed to hash password: ", err)
+	}
+
+	admin := models.User{
+		Username: *username,
+		Password: hashedPassword,
+		Phone:    *phone,
+		Role:     consts.Admin,
+	}
+	if err := db.DB.Table(consts.UserTable).Create(&admin).Error; err != nil {
+		log.Fatal("failed to create admin: ", err)
+	}
+
+	log.Printf("\033[32madmin %s created\033[0m\n", *phone)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/OSS"
+	"log"
+	"os"
+	"time"
+)
+
+// 清理对象存储中没有被房源引用的图片和富文本, 默认只输出报告
+// usage: go run ./cmd/oss-gc -grace 72h [-delete]
+func main() {
+	grace := flag.Duration("grace", consts.ThreeDays, "only delete orphans uploaded and dereferenced before this duration")
+	deleteOrphans := flag.Bool("delete", false, "delete orphans, otherwise only print the report")
+	flag.Parse()
+
+	if *grace < consts.OSSGCMinGrace {
+		log.Fatalf("grace period should be at least %s", consts.OSSGCMinGrace)
+	}
+
+	db.Init()
+	OSS.Init()
+
+	refs, err := OSS.ReferencedURLs(db.DB, time.Now().Add(-*grace))
+	if err != nil {
+		log.Fatal("failed to query referenced files: ", err)
+	}
+
+	report, err := OSS.CollectGarbage(context.Background(), refs, OSS.GCOptions{GracePeriod: *grace, DryRun: !*deleteOrphans})
+	if err != nil {
+		log.Fatal("failed to collect garbage: ", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+
+	if report.DryRun {
+		log.Printf("\033[32mfound %d orphans (%d bytes), run with -delete to remove them\033[0m\n", report.OrphanCount, report.OrphanBytes)
+	} else {
+		log.Printf("\033[32mdeleted %d of %d orphans\033[0m\n", report.Deleted, report.OrphanCount)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"github.com/hewo233/house-system-backend/utils/search"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 重建全部房源的搜索索引, 富文本从 OSS 下载后提取文字
+// usage: go run ./cmd/reindex-search
+func main() {
+	db.Init()
+	division.Init()
+	search.DistrictName = division.FullName
+	search.Init()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var properties []models.Property
+	count := 0
+	err := db.DB.Table(consts.PropertyTable).FindInBatches(&properties, 100, func(tx *gorm.DB, batch int) error {
+		for _, property := range properties {
+			doc := search.Document{
+				PropertyID: property.ID,
+				Address:    property.Address.Details,
+				District:   search.DistrictName(property.Address.Distinct),
+			}
+
+			content := ""
+			if property.RichTextURL != "" && property.RichTextURL != consts.DefaultHTMLUrl {
+				text, err := fetchRichText(client, property.RichTextURL)
+				if err != nil {
+					log.Printf("property %d: failed to fetch rich text: %v\n", property.ID, err)
+				} else {
+					content = text
+				}
+			}
+			doc.Content = &content
+
+			if err := search.Index(&doc); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		log.Fatal("failed to reindex: ", err)
+	}
+
+	log.Printf("\033[32mreindexed %d properties\033[0m\n", count)
+}
+
+func fetchRichText(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return search.HTMLText(resp.Body)
+}
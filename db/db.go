@@ -32,6 +32,58 @@ func UpdateDB() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = DB.Table(consts.InviteRedemptionTable).AutoMigrate(&models.InviteRedemption{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.SessionTable).AutoMigrate(&models.Session{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.UsedRefreshTokenTable).AutoMigrate(&models.UsedRefreshToken{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.AuditLogTable).AutoMigrate(&models.AuditLog{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.PropertyPriceHistoryTable).AutoMigrate(&models.PropertyPriceHistory{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.PropertyStatusTable).AutoMigrate(&models.PropertyStatusTransition{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.CustomerRequirementTable).AutoMigrate(&models.CustomerRequirement{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.SavedSearchTable).AutoMigrate(&models.SavedSearch{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.NotificationTable).AutoMigrate(&models.Notification{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.CustomerFollowUpTable).AutoMigrate(&models.CustomerFollowUp{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.AppointmentTable).AutoMigrate(&models.Appointment{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.PropertySearchDocTable).AutoMigrate(&models.PropertySearchDoc{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Table(consts.FilterBucketTable).AutoMigrate(&models.FilterBucket{})
+	if err != nil {
+		log.Fatal(err)
+	}
 	log.Println("\033[32mAutoMigrate success\033[0m")
 }
 
@@ -1,92 +1,74 @@
 package handler
 
 import (
-	"bufio"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/hewo233/house-system-backend/db"
 	"github.com/hewo233/house-system-backend/models"
 	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
 	"github.com/hewo233/house-system-backend/utils/jwt"
 	"github.com/hewo233/house-system-backend/utils/password"
+	"github.com/hewo233/house-system-backend/utils/rbac"
 	"log"
 	"net/http"
-	"os"
-	"strings"
 )
 
-func getAdminPassword() (string, error) {
-	file, err := os.Open(consts.AdminPassFile)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	var hashedPassword string
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "HashedPassword=") {
-			hashedPassword = strings.TrimPrefix(line, "HashedPassword=")
-			break
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
-
-	if hashedPassword == "" {
-		return "", fmt.Errorf("admin password in system is empty")
-	}
-
-	return hashedPassword, nil
+type AdminLoginRequest struct {
+	Phone    string `json:"phone" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
 func AdminLogin(c *gin.Context) {
-	adminKey, err := getAdminPassword()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"errno":   50010,
-			"message": "failed to get admin password: " + err.Error(),
+	var req AdminLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40010,
+			"message": "failed to bind Admin Login Request: " + err.Error(),
 		})
-		log.Println("failed to get admin password: ", err.Error())
 		c.Abort()
 		return
 	}
 
-	var req struct {
-		Password string `json:"password" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if len(req.Phone) != 11 || req.Password == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"errno":   40010,
-			"message": "failed to bind Admin Login Request: " + err.Error(),
+			"message": "invalid phone or password",
+		})
+		c.Abort()
+		return
+	}
+
+	user := models.NewUser()
+	result := db.DB.Table(consts.UserTable).Where("phone = ?", req.Phone).Limit(1).Find(user)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50010,
+			"message": "failed to query database: " + result.Error.Error(),
 		})
 		c.Abort()
 		return
 	}
 
-	if req.Password == "" {
+	// 不区分用户不存在和不是管理员, 避免泄露管理员账号
+	if result.RowsAffected == 0 || user.Role != consts.RoleAdmin {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"errno":   40010,
-			"message": "password is empty",
+			"errno":   40011,
+			"message": "admin phone or password is incorrect",
 		})
 		c.Abort()
 		return
 	}
 
-	if err := password.CheckHashed(req.Password, adminKey); err != nil {
+	if err := password.CheckHashed(req.Password, user.Password); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"errno":   40011,
-			"message": "admin password is incorrect",
+			"message": "admin phone or password is incorrect",
 		})
 		c.Abort()
 		return
 	}
 
-	jwtToken, err := jwt.GenerateJWT("admin", consts.Admin)
+	jwtToken, refreshToken, err := jwt.CreateSession(user.Phone, consts.Admin)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50011,
@@ -96,46 +78,17 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
+	log.Println("Admin login: ", user.Phone)
+
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "login as admin successfully",
-		"token":   jwtToken,
+		"errno":         20000,
+		"message":       "login as admin successfully",
+		"token":         jwtToken,
+		"refresh_token": refreshToken,
 	})
 }
 
-func CheckAdmin(c *gin.Context) bool {
-	phone, _, err := jwt.GetPhoneFromJWT(c)
-	if phone != "admin" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"errno":   40012,
-			"message": "not admin",
-		})
-		c.Abort()
-		return false
-	}
-	if err != nil {
-		if err.Error() == "user not found" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"errno":   40100,
-				"message": "Unauthorized, user in jwt not found",
-			})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"errno":   50005,
-				"message": "failed to get user info: " + err.Error(),
-			})
-		}
-		c.Abort()
-		return false
-	}
-	return true
-}
-
 func AdminRemoveUserByPhone(c *gin.Context) {
-	if ok := CheckAdmin(c); !ok {
-		return
-	}
-
 	phone := c.Param("phone")
 	if len(phone) != 11 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -164,7 +117,16 @@ func AdminRemoveUserByPhone(c *gin.Context) {
 		return
 	}
 
-	log.Println("Deleting user: ", user.Phone)
+	if user.Phone == c.GetString("phone") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40014,
+			"message": "admin cannot delete self",
+		})
+		c.Abort()
+		return
+	}
+
+	log.Printf("Admin %s deleting user: %s\n", c.GetString("phone"), user.Phone)
 	result = db.DB.Table(consts.UserTable).Where("phone = ?", phone).Delete(user)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -175,6 +137,17 @@ func AdminRemoveUserByPhone(c *gin.Context) {
 		return
 	}
 
+	if err := jwt.RevokeSubjectSessions(user.Phone, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50014,
+			"message": "failed to revoke user sessions: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionDelete, audit.EntityUser, user.Phone, user, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "delete user successfully",
@@ -183,62 +156,103 @@ func AdminRemoveUserByPhone(c *gin.Context) {
 
 }
 
-func AdminModifyInviteCode(c *gin.Context) {
-	if ok := CheckAdmin(c); !ok {
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func AdminAssignRole(c *gin.Context) {
+	phone := c.Param("phone")
+	if len(phone) != 11 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40013,
+			"message": "invalid phone",
+		})
+		c.Abort()
 		return
 	}
 
-	var req struct {
-		InviteCode string `json:"invite_code" binding:"required"`
-	}
+	var req AssignRoleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40015,
+			"message": "failed to bind AssignRole Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if !rbac.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40016,
+			"message": "invalid role: " + req.Role,
+		})
+		c.Abort()
+		return
+	}
+
+	user := models.NewUser()
+	result := db.DB.Table(consts.UserTable).Where("phone = ?", phone).Limit(1).Find(user)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50015,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"errno":   40010,
-			"message": "failed to bind request: " + err.Error(),
+			"message": "user not found",
 		})
 		c.Abort()
 		return
 	}
-	inviteCode := req.InviteCode
 
-	if err := db.DB.Table(consts.InviteCodeTable).Where("id = ?", 1).First(&models.InviteCode{}).Error; err != nil {
-		if err.Error() == "record not found" {
-			// create
-			inviteCodeModel := models.InviteCode{
-				Code: inviteCode,
-			}
-			if err := db.DB.Table(consts.InviteCodeTable).Create(&inviteCodeModel).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"errno":   50018,
-					"message": "failed to create invite code: " + err.Error(),
-				})
-				c.Abort()
-				return
-			}
-		} else {
+	// 至少保留一个管理员
+	if user.Role == consts.RoleAdmin && req.Role != consts.RoleAdmin {
+		var adminCount int64
+		if err := db.DB.Table(consts.UserTable).Where("role = ? AND deleted_at IS NULL", consts.RoleAdmin).Count(&adminCount).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"errno":   50019,
+				"errno":   50015,
 				"message": "failed to query database: " + err.Error(),
 			})
 			c.Abort()
 			return
 		}
+		if adminCount <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40017,
+				"message": "cannot remove the last admin",
+			})
+			c.Abort()
+			return
+		}
 	}
 
-	// update
-	inviteCodeModel := models.InviteCode{
-		Code: inviteCode,
-	}
-	if err := db.DB.Table(consts.InviteCodeTable).Where("id = ?", 1).Updates(&inviteCodeModel).Error; err != nil {
+	if err := db.DB.Table(consts.UserTable).Where("id = ?", user.ID).Update("role", req.Role).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"errno":   50020,
-			"message": "failed to update invite code: " + err.Error(),
+			"errno":   50016,
+			"message": "failed to update user role: " + err.Error(),
 		})
 		c.Abort()
 		return
 	}
+
+	audit.Record(c, audit.ActionUpdate, audit.EntityUser, user.Phone, gin.H{"role": user.Role}, gin.H{"role": req.Role})
+
+	log.Printf("Admin %s assign role %s to user %s\n", c.GetString("phone"), req.Role, user.Phone)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "assign role successfully",
+	})
+}
+
+func AdminListRoles(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
-		"message": "update invite code successfully",
+		"message": "list roles successfully",
+		"results": rbac.RolePermissions(),
 	})
 }
@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"github.com/hewo233/house-system-backend/utils/rbac"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultAppointmentMinutes = 60
+	maxAppointmentMinutes     = 8 * 60
+)
+
+var errAppointmentConflict = errors.New("agent already has an appointment at this time")
+
+type CreateAppointmentRequest struct {
+	CustomerID string    `json:"customer_id" binding:"required"`
+	HouseID    uint      `json:"house_id" binding:"required"`
+	AgentID    uint      `json:"agent_id"` // 为空时为当前用户
+	StartAt    time.Time `json:"start_at" binding:"required"`
+	Duration   int       `json:"duration"` // 分钟, 为空时 60
+	Note       string    `json:"note"`
+}
+
+func (req *CreateAppointmentRequest) Validate() (bool, string) {
+	if req.StartAt.Before(time.Now()) {
+		return false, "预约时间必须晚于当前时间"
+	}
+	if req.Duration < 0 || req.Duration > maxAppointmentMinutes {
+		return false, "预约时长必须在0-480分钟之间"
+	}
+	if len(req.Note) > 255 {
+		return false, "备注不能超过255个字符"
+	}
+	return true, ""
+}
+
+type ModifyAppointmentRequest struct {
+	StartAt  *time.Time `json:"start_at"`
+	Duration *int       `json:"duration"`
+	Status   *string    `json:"status"` // 只能从 scheduled 改为 completed 或 cancelled
+	Note     *string    `json:"note"`
+}
+
+func (req *ModifyAppointmentRequest) Validate() (bool, string) {
+	if req.StartAt != nil && req.StartAt.Before(time.Now()) {
+		return false, "预约时间必须晚于当前时间"
+	}
+	if req.Duration != nil && (*req.Duration <= 0 || *req.Duration > maxAppointmentMinutes) {
+		return false, "预约时长必须在1-480分钟之间"
+	}
+	if req.Status != nil && *req.Status != consts.AppointmentCompleted && *req.Status != consts.AppointmentCancelled {
+		return false, "状态只能改为 completed 或 cancelled"
+	}
+	if req.Note != nil && len(*req.Note) > 255 {
+		return false, "备注不能超过255个字符"
+	}
+	return true, ""
+}
+
+// saveAppointment 锁住经纪人后检查时间冲突再保存, 避免并发预约同一时段
+func saveAppointment(appointment *models.Appointment) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var agent models.User
+		if err := tx.Table(consts.UserTable).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", appointment.AgentID).First(&agent).Error; err != nil {
+			return err
+		}
+
+		query := tx.Table(consts.AppointmentTable).
+			Where("agent_id = ? AND status = ? AND start_at < ? AND end_at > ?", appointment.AgentID, consts.AppointmentScheduled, appointment.EndAt, appointment.StartAt)
+		if appointment.ID != 0 {
+			query = query.Where("id <> ?", appointment.ID)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errAppointmentConflict
+		}
+
+		return tx.Table(consts.AppointmentTable).Save(appointment).Error
+	})
+}
+
+func CreateAppointment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40210,
+			"message": "failed to bind CreateAppointment Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40211,
+			"message": "invalid CreateAppointment Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	customer, ok := loadCustomer(c, user, req.CustomerID, true)
+	if !ok {
+		return
+	}
+
+	var property models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id = ?", req.HouseID).First(&property).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40212,
+			"message": "property does not exist: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if property.Status != consts.PropertyStatusActive && property.Status != consts.PropertyStatusReserved {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40213,
+			"message": "property is not available for viewing, status: " + property.Status,
+		})
+		c.Abort()
+		return
+	}
+
+	// 替其他经纪人预约需要 customer:manage 权限
+	agentID := user.ID
+	if req.AgentID != 0 && req.AgentID != user.ID {
+		if !rbac.HasPermission(user.Role, consts.PermCustomerManage) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"errno":   40310,
+				"message": "Forbidden, only manager can book for other agents",
+			})
+			c.Abort()
+			return
+		}
+		agentID = req.AgentID
+	}
+
+	duration := req.Duration
+	if duration == 0 {
+		duration = defaultAppointmentMinutes
+	}
+
+	appointment := models.Appointment{
+		CustomerID: customer.ID,
+		PropertyID: property.ID,
+		AgentID:    agentID,
+		StartAt:    req.StartAt,
+		EndAt:      req.StartAt.Add(time.Duration(duration) * time.Minute),
+		Status:     consts.AppointmentScheduled,
+		Note:       req.Note,
+		CreatedBy:  user.ID,
+	}
+	if err := saveAppointment(&appointment); err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "create appointment successfully",
+		"result":  appointment,
+	})
+}
+
+func respondAppointmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAppointmentConflict):
+		c.JSON(http.StatusConflict, gin.H{
+			"errno":   40910,
+			"message": err.Error(),
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40214,
+			"message": "agent does not exist",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50210,
+			"message": "failed to save appointment: " + err.Error(),
+		})
+	}
+	c.Abort()
+}
+
+// ModifyAppointment 改期、完成或取消预约, 只有负责的经纪人、创建人或管理者可以修改
+func ModifyAppointment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	appointment := models.NewAppointment()
+	result := db.DB.Table(consts.AppointmentTable).Where("id = ?", c.Param("id")).Limit(1).Find(appointment)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50211,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40215,
+			"message": "appointment not found",
+		})
+		c.Abort()
+		return
+	}
+
+	if appointment.AgentID != user.ID && appointment.CreatedBy != user.ID && !rbac.HasPermission(user.Role, consts.PermCustomerManage) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"errno":   40311,
+			"message": "Forbidden, only the agent or manager can modify this appointment",
+		})
+		c.Abort()
+		return
+	}
+
+	var req ModifyAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40216,
+			"message": "failed to bind ModifyAppointment Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40217,
+			"message": "invalid ModifyAppointment Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	if appointment.Status != consts.AppointmentScheduled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40218,
+			"message": "appointment is already " + appointment.Status,
+		})
+		c.Abort()
+		return
+	}
+
+	duration := appointment.EndAt.Sub(appointment.StartAt)
+	if req.Duration != nil {
+		duration = time.Duration(*req.Duration) * time.Minute
+	}
+	if req.StartAt != nil {
+		appointment.StartAt = *req.StartAt
+	}
+	appointment.EndAt = appointment.StartAt.Add(duration)
+	if req.Status != nil {
+		appointment.Status = *req.Status
+	}
+	if req.Note != nil {
+		appointment.Note = *req.Note
+	}
+
+	if err := saveAppointment(appointment); err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "update appointment successfully",
+		"result":  appointment,
+	})
+}
+
+type AgendaAppointment struct {
+	models.Appointment
+	CustomerCode string         `json:"customer_code"` // customers 表的 customer_id
+	CustomerName string         `json:"customer_name"`
+	Address      models.Address `json:"address"`
+	Region       division.Names `json:"region"`
+}
+
+// GetMyAgenda 当前用户某一天的带看预约和待跟进客户, date 默认今天
+func GetMyAgenda(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	day := time.Now()
+	if date := c.Query("date"); date != "" {
+		var err error
+		day, err = time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40219,
+				"message": "invalid date, format should be 2006-01-02",
+			})
+			c.Abort()
+			return
+		}
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+
+	var appointments []models.Appointment
+	if err := db.DB.Table(consts.AppointmentTable).
+		Where("agent_id = ? AND status <> ? AND start_at >= ? AND start_at < ?", user.ID, consts.AppointmentCancelled, start, end).
+		Order("start_at ASC").Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50212,
+			"message": "failed to query appointments: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	customerIDs := make([]uint, 0, len(appointments))
+	propertyIDs := make([]uint, 0, len(appointments))
+	for _, appointment := range appointments {
+		customerIDs = append(customerIDs, appointment.CustomerID)
+		propertyIDs = append(propertyIDs, appointment.PropertyID)
+	}
+
+	var followUps []models.CustomerFollowUp
+	if err := db.DB.Table(consts.CustomerFollowUpTable).
+		Where("user_id = ? AND next_action_at >= ? AND next_action_at < ?", user.ID, start, end).
+		Order("next_action_at ASC").Find(&followUps).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50213,
+			"message": "failed to query follow-ups: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	for _, followUp := range followUps {
+		customerIDs = append(customerIDs, followUp.CustomerID)
+	}
+
+	// 已删除的客户和房源也要显示, 所以使用 Unscoped
+	var customers []models.Customer
+	if err := db.DB.Table(consts.CustomerTable).Unscoped().Where("id IN ?", customerIDs).Find(&customers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50214,
+			"message": "failed to query customers: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	customerMap := make(map[uint]models.Customer, len(customers))
+	for _, customer := range customers {
+		customerMap[customer.ID] = customer
+	}
+
+	var properties []models.Property
+	if err := db.DB.Table(consts.PropertyTable).Unscoped().Where("id IN ?", propertyIDs).Find(&properties).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50215,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	addressMap := make(map[uint]models.Address, len(properties))
+	for _, property := range properties {
+		addressMap[property.ID] = property.Address
+	}
+
+	agenda := make([]AgendaAppointment, 0, len(appointments))
+	for _, appointment := range appointments {
+		agenda = append(agenda, AgendaAppointment{
+			Appointment:  appointment,
+			CustomerCode: customerMap[appointment.CustomerID].CustomerID,
+			CustomerName: customerMap[appointment.CustomerID].Name,
+			Address:      addressMap[appointment.PropertyID],
+			Region:       division.Resolve(addressMap[appointment.PropertyID].Distinct),
+		})
+	}
+
+	type agendaFollowUp struct {
+		models.CustomerFollowUp
+		CustomerCode string `json:"customer_code"`
+		CustomerName string `json:"customer_name"`
+	}
+	todo := make([]agendaFollowUp, 0, len(followUps))
+	for _, followUp := range followUps {
+		todo = append(todo, agendaFollowUp{
+			CustomerFollowUp: followUp,
+			CustomerCode:     customerMap[followUp.CustomerID].CustomerID,
+			CustomerName:     customerMap[followUp.CustomerID].Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":        20000,
+		"message":      "get agenda successfully",
+		"date":         start.Format("2006-01-02"),
+		"appointments": agenda,
+		"follow_ups":   todo,
+	})
+}
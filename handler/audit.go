@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"net/http"
+	"time"
+)
+
+var auditLogSortKeys = map[string]string{
+	"created_at": "created_at",
+}
+
+// parseAuditTime 支持 2006-01-02 和 RFC3339 两种格式
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// AdminListAuditLogs 按操作人、操作、对象和时间范围筛选审计日志
+func AdminListAuditLogs(c *gin.Context) {
+	p, err := page.Parse(c, auditLogSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40140,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	query := db.DB.Table(consts.AuditLogTable)
+
+	if actor := c.Query("actor"); actor != "" {
+		query = query.Where("actor_phone = ?", actor)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseAuditTime(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40141,
+				"message": "invalid from time: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseAuditTime(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40142,
+				"message": "invalid to time: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	logs := make([]models.AuditLog, 0)
+	total, err := p.Find(query, &logs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50140,
+			"message": "failed to query audit logs: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "list audit logs successfully",
+		"results":         logs,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/utils/jwt"
+	"net/http"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40130,
+			"message": "failed to bind Refresh Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	accessToken, refreshToken, err := jwt.RefreshSession(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"errno":   40134,
+				"message": "Unauthorized, refresh token has already been used, the session has been revoked, please login again",
+			})
+		} else if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"errno":   40131,
+				"message": "Unauthorized, refresh token is invalid, revoked or expired",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50130,
+				"message": "failed to refresh token: " + err.Error(),
+			})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":         20000,
+		"message":       "refresh token successfully",
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+func Logout(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40132,
+			"message": "failed to bind Logout Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if err := jwt.RevokeSessionByRefreshToken(req.RefreshToken); err != nil {
+		if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40133,
+				"message": "refresh token is invalid or already logged out",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50131,
+				"message": "failed to logout: " + err.Error(),
+			})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "logout successfully",
+	})
+}
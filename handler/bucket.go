@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bucketFieldPrice  = "price"
+	bucketFieldSize   = "size"
+	bucketFieldHeight = "height"
+
+	maxBucketsPerField = 20
+	// 多实例部署时其他实例最迟在这段时间后读到新的配置
+	bucketCacheTTL = time.Minute
+	// 单价 (万/㎡) 的 SQL 表达式
+	unitPriceExpr = "price / NULLIF(size, 0)"
+)
+
+// Bucket 筛选区间, 左闭右开, Max 为空表示不设上限
+type Bucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Label string   `json:"label"`
+}
+
+func (b Bucket) contains(value float64) bool {
+	return value >= b.Min && (b.Max == nil || value < *b.Max)
+}
+
+func bucketMax(v float64) *float64 {
+	return &v
+}
+
+// 没有配置时使用的默认区间, 顺序即筛选请求中的下标 1, 2, 3...
+var defaultBuckets = map[string][]Bucket{
+	bucketFieldPrice: {
+		{Min: 0, Max: bucketMax(100), Label: "100万以下"},
+		{Min: 100, Max: bucketMax(300), Label: "100-300万"},
+		{Min: 300, Max: bucketMax(500), Label: "300-500万"},
+		{Min: 500, Max: bucketMax(1000), Label: "500-1000万"},
+		{Min: 1000, Label: "1000万以上"},
+	},
+	bucketFieldSize: {
+		{Min: 0, Max: bucketMax(50), Label: "50㎡以下"},
+		{Min: 50, Max: bucketMax(100), Label: "50-100㎡"},
+		{Min: 100, Max: bucketMax(150), Label: "100-150㎡"},
+		{Min: 150, Max: bucketMax(200), Label: "150-200㎡"},
+		{Min: 200, Label: "200㎡以上"},
+	},
+	bucketFieldHeight: {
+		{Min: 1, Max: bucketMax(7), Label: "低楼层 (1-6)"},
+		{Min: 7, Max: bucketMax(16), Label: "中楼层 (7-15)"},
+		{Min: 16, Label: "高楼层 (16以上)"},
+	},
+}
+
+var bucketCache = struct {
+	sync.RWMutex
+	buckets  map[string][]Bucket // 为 nil 时需要重新加载
+	loadedAt time.Time
+}{}
+
+func loadBuckets() map[string][]Bucket {
+	buckets := make(map[string][]Bucket, len(defaultBuckets))
+	for field, list := range defaultBuckets {
+		buckets[field] = list
+	}
+
+	var rows []models.FilterBucket
+	if err := db.DB.Table(consts.FilterBucketTable).Order("field, position").Find(&rows).Error; err != nil {
+		log.Println("failed to load filter buckets, using defaults: ", err)
+		return buckets
+	}
+
+	configured := make(map[string][]Bucket)
+	for _, row := range rows {
+		configured[row.Field] = append(configured[row.Field], Bucket{Min: row.Min, Max: row.Max, Label: row.Label})
+	}
+	for field, list := range configured {
+		buckets[field] = list
+	}
+	return buckets
+}
+
+// getBuckets 返回某个字段当前生效的区间, 数据库没有配置时使用默认值
+func getBuckets(field string) []Bucket {
+	bucketCache.RLock()
+	buckets := bucketCache.buckets
+	fresh := time.Since(bucketCache.loadedAt) < bucketCacheTTL
+	bucketCache.RUnlock()
+	if buckets != nil && fresh {
+		return buckets[field]
+	}
+
+	bucketCache.Lock()
+	defer bucketCache.Unlock()
+	if bucketCache.buckets == nil || time.Since(bucketCache.loadedAt) >= bucketCacheTTL {
+		bucketCache.buckets = loadBuckets()
+		bucketCache.loadedAt = time.Now()
+	}
+	return bucketCache.buckets[field]
+}
+
+func invalidateBuckets() {
+	bucketCache.Lock()
+	bucketCache.buckets = nil
+	bucketCache.Unlock()
+}
+
+// bucketAt 下标从 1 开始, 0 为兼容旧版本的空区间
+func bucketAt(buckets []Bucket, index int) Bucket {
+	if index <= 0 || index > len(buckets) {
+		return Bucket{Min: 0, Max: bucketMax(0)}
+	}
+	return buckets[index-1]
+}
+
+func inBuckets(value float64, field string, indexes []int) bool {
+	buckets := getBuckets(field)
+	for _, i := range indexes {
+		if bucketAt(buckets, i).contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func validBucketIndexes(field string, indexes []int) bool {
+	n := len(getBuckets(field))
+	for _, i := range indexes {
+		if i < 0 || i > n {
+			return false
+		}
+	}
+	return true
+}
+
+func bucketSQL(column string, bucket Bucket) (string, []interface{}) {
+	if bucket.Max == nil {
+		return fmt.Sprintf("%s >= ?", column), []interface{}{bucket.Min}
+	}
+	return fmt.Sprintf("(%s >= ? AND %s < ?)", column, column), []interface{}{bucket.Min, *bucket.Max}
+}
+
+// applyBucketFilter 选中多个区间时取并集
+func applyBucketFilter(query *gorm.DB, column string, field string, indexes []int) *gorm.DB {
+	if len(indexes) == 0 {
+		return query
+	}
+	buckets := getBuckets(field)
+	conditions := make([]string, 0, len(indexes))
+	args := make([]interface{}, 0, len(indexes)*2)
+	for _, i := range indexes {
+		condition, conditionArgs := bucketSQL(column, bucketAt(buckets, i))
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+	return query.Where(strings.Join(conditions, " OR "), args...)
+}
+
+// NumberRange 自定义区间, 两端都包含, 为空表示不限
+type NumberRange struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+func (r *NumberRange) Validate(name string) (bool, string) {
+	if r == nil {
+		return true, ""
+	}
+	if (r.Min != nil && *r.Min < 0) || (r.Max != nil && *r.Max < 0) {
+		return false, name + "不能小于0"
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return false, name + "的最小值不能大于最大值"
+	}
+	return true, ""
+}
+
+// contains 为空或未设置的一端表示不限
+func (r *NumberRange) contains(value float64) bool {
+	if r == nil {
+		return true
+	}
+	return (r.Min == nil || value >= *r.Min) && (r.Max == nil || value <= *r.Max)
+}
+
+func applyRangeFilter(query *gorm.DB, expr string, r *NumberRange) *gorm.DB {
+	if r == nil {
+		return query
+	}
+	if r.Min != nil {
+		query = query.Where(expr+" >= ?", *r.Min)
+	}
+	if r.Max != nil {
+		query = query.Where(expr+" <= ?", *r.Max)
+	}
+	return query
+}
+
+type BucketFacet struct {
+	Index int      `json:"index"`
+	Label string   `json:"label"`
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int64    `json:"count"`
+}
+
+// bucketFacets 统计每个区间的房源数量, 不包含该字段自身的筛选条件, 方便前端展示切换后的数量
+func bucketFacets(req *SelectPropertiesRequest, field string) ([]BucketFacet, error) {
+	others := withoutFilter(req, field)
+
+	buckets := getBuckets(field)
+	facets := make([]BucketFacet, 0, len(buckets))
+	if len(buckets) == 0 {
+		return facets, nil
+	}
+
+	// 在数据库中用 CASE 把每个房源归到区间, 再按区间计数
+	cases := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, len(buckets)*2)
+	for i, bucket := range buckets {
+		condition, conditionArgs := bucketSQL(field, bucket)
+		cases = append(cases, fmt.Sprintf("WHEN %s THEN %d", condition, i+1))
+		args = append(args, conditionArgs...)
+	}
+
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	query := applyPropertyFilters(db.DB.Table(consts.PropertyTable).Where("deleted_at IS NULL"), &others)
+	err := query.Select(fmt.Sprintf("CASE %s ELSE 0 END AS bucket, COUNT(*) AS count", strings.Join(cases, " ")), args...).
+		Group("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+	for i, bucket := range buckets {
+		facets = append(facets, BucketFacet{
+			Index: i + 1,
+			Label: bucket.Label,
+			Min:   bucket.Min,
+			Max:   bucket.Max,
+			Count: counts[i+1],
+		})
+	}
+	return facets, nil
+}
+
+func ListBuckets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "list filter buckets successfully",
+		"results": gin.H{
+			bucketFieldPrice:  getBuckets(bucketFieldPrice),
+			bucketFieldSize:   getBuckets(bucketFieldSize),
+			bucketFieldHeight: getBuckets(bucketFieldHeight),
+		},
+	})
+}
+
+type SetBucketsRequest struct {
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Validate 区间按顺序排列且不重叠, 只有最后一个区间可以不设上限
+func (req *SetBucketsRequest) Validate() (bool, string) {
+	if len(req.Buckets) == 0 || len(req.Buckets) > maxBucketsPerField {
+		return false, fmt.Sprintf("区间数量必须在1-%d之间", maxBucketsPerField)
+	}
+	for i, bucket := range req.Buckets {
+		if bucket.Min < 0 {
+			return false, "区间下限不能小于0"
+		}
+		if bucket.Max == nil && i != len(req.Buckets)-1 {
+			return false, "只有最后一个区间可以不设上限"
+		}
+		if bucket.Max != nil && *bucket.Max <= bucket.Min {
+			return false, "区间上限必须大于下限"
+		}
+		if i > 0 && bucket.Min < *req.Buckets[i-1].Max {
+			return false, "区间不能重叠, 且必须从小到大排列"
+		}
+		if len(bucket.Label) > 50 {
+			return false, "区间名称不能超过50个字符"
+		}
+	}
+	return true, ""
+}
+
+// AdminSetBuckets 替换某个字段的全部区间, 已保存的筛选条件中的下标含义会随之改变
+func AdminSetBuckets(c *gin.Context) {
+	field := c.Param("field")
+	if _, ok := defaultBuckets[field]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40240,
+			"message": "field must be price, size or height",
+		})
+		c.Abort()
+		return
+	}
+
+	var req SetBucketsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40241,
+			"message": "failed to bind SetBuckets Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40242,
+			"message": "invalid SetBuckets Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	before := getBuckets(field)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(consts.FilterBucketTable).Unscoped().Where("field = ?", field).Delete(&models.FilterBucket{}).Error; err != nil {
+			return err
+		}
+		rows := make([]models.FilterBucket, 0, len(req.Buckets))
+		for i, bucket := range req.Buckets {
+			rows = append(rows, models.FilterBucket{
+				Field:    field,
+				Position: i + 1,
+				Min:      bucket.Min,
+				Max:      bucket.Max,
+				Label:    bucket.Label,
+			})
+		}
+		return tx.Table(consts.FilterBucketTable).Create(&rows).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50240,
+			"message": "failed to save filter buckets: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	invalidateBuckets()
+	audit.Record(c, audit.ActionUpdate, audit.EntityFilterBucket, field, before, req.Buckets)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "save filter buckets successfully",
+		"results": getBuckets(field),
+	})
+}
+
+// AdminResetBuckets 删除配置, 恢复默认区间
+func AdminResetBuckets(c *gin.Context) {
+	field := c.Param("field")
+	if _, ok := defaultBuckets[field]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40240,
+			"message": "field must be price, size or height",
+		})
+		c.Abort()
+		return
+	}
+
+	before := getBuckets(field)
+	if err := db.DB.Table(consts.FilterBucketTable).Unscoped().Where("field = ?", field).Delete(&models.FilterBucket{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50241,
+			"message": "failed to reset filter buckets: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	invalidateBuckets()
+	audit.Record(c, audit.ActionDelete, audit.EntityFilterBucket, field, before, defaultBuckets[field])
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "reset filter buckets successfully",
+		"results": getBuckets(field),
+	})
+}
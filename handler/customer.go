@@ -5,12 +5,32 @@ import (
 	"github.com/hewo233/house-system-backend/db"
 	"github.com/hewo233/house-system-backend/models"
 	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"github.com/hewo233/house-system-backend/utils/rbac"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
 	"net/http"
+	"strings"
 )
 
+var customerSortKeys = map[string]string{
+	"created_at": "created_at",
+	"name":       "name",
+}
+
+// maskCustomerPhone 只有自己录入的客户或拥有 customer:view_phone 权限时可以看到完整信息
+func maskCustomerPhone(user *models.User, customer *models.Customer) {
+	if customer.UserID != user.ID && !rbac.HasPermission(user.Role, consts.PermCustomerViewPhone) {
+		customer.Phone = "***********"
+	}
+}
+
 func CreateCustomer(c *gin.Context) {
 
-	if ok := CheckUser(c); !ok {
+	user, ok := currentUser(c)
+	if !ok {
 		return
 	}
 
@@ -45,6 +65,7 @@ func CreateCustomer(c *gin.Context) {
 	}
 
 	// 创建 customer
+	req.UserID = user.ID
 	if err := db.DB.Table(consts.CustomerTable).Create(req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50081,
@@ -54,6 +75,8 @@ func CreateCustomer(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.ActionCreate, audit.EntityCustomer, req.CustomerID, nil, req)
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20080,
 		"message": "create customer successfully",
@@ -62,62 +85,79 @@ func CreateCustomer(c *gin.Context) {
 
 func UserListCustomers(c *gin.Context) {
 
-	if ok := CheckUser(c); !ok {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	p, err := page.Parse(c, customerSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40089,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
 		return
 	}
 
 	customers := make([]models.Customer, 0)
-	result := db.DB.Table(consts.CustomerTable).Omit("phone").Find(&customers)
-	if result.Error != nil {
+	total, err := p.Find(db.DB.Table(consts.CustomerTable), &customers)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50082,
-			"message": "failed to query database: " + result.Error.Error(),
+			"message": "failed to query database: " + err.Error(),
 		})
 		c.Abort()
 		return
 	}
 
 	for i := range customers {
-		customers[i].Phone = "***********"
+		maskCustomerPhone(user, &customers[i])
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "list customer successfully",
-		"results": customers,
+		"errno":           20000,
+		"message":         "list customer successfully",
+		"results":         customers,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
 	})
 }
 
 func AdminListCustomers(c *gin.Context) {
 
-	if ok := CheckAdmin(c); !ok {
+	p, err := page.Parse(c, customerSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40089,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
 		return
 	}
 
 	customers := make([]models.Customer, 0)
-	result := db.DB.Table(consts.CustomerTable).Find(&customers)
-	if result.Error != nil {
+	total, err := p.Find(db.DB.Table(consts.CustomerTable), &customers)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50082,
-			"message": "failed to query database: " + result.Error.Error(),
+			"message": "failed to query database: " + err.Error(),
 		})
 		c.Abort()
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "list customer successfully",
-		"results": customers,
+		"errno":           20000,
+		"message":         "list customer successfully",
+		"results":         customers,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
 	})
 }
 
 func ModifyCustomers(c *gin.Context) {
 
-	if ok := CheckAdmin(c); !ok {
-		return
-	}
-
 	customerID := c.Param("customer_id")
 
 	req := models.NewCustomer()
@@ -130,7 +170,29 @@ func ModifyCustomers(c *gin.Context) {
 		return
 	}
 
-	result := db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Updates(req)
+	before := models.NewCustomer()
+	result := db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Limit(1).Find(before)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50083,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40083,
+			"message": "customer_id not exists",
+		})
+		c.Abort()
+		return
+	}
+
+	// 归属经纪人只能通过 reassign 修改
+	req.UserID = 0
+
+	result = db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Updates(req)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50083,
@@ -149,6 +211,11 @@ func ModifyCustomers(c *gin.Context) {
 		return
 	}
 
+	after := models.NewCustomer()
+	if err := db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).First(after).Error; err == nil {
+		audit.Record(c, audit.ActionUpdate, audit.EntityCustomer, customerID, before, after)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "update customer successfully",
@@ -157,10 +224,6 @@ func ModifyCustomers(c *gin.Context) {
 
 func DeleteCustomers(c *gin.Context) {
 
-	if ok := CheckAdmin(c); !ok {
-		return
-	}
-
 	customerID := c.Param("customer_id")
 	if customerID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -171,7 +234,26 @@ func DeleteCustomers(c *gin.Context) {
 		return
 	}
 
-	result := db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Delete(&models.Customer{})
+	before := models.NewCustomer()
+	result := db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Limit(1).Find(before)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50084,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40084,
+			"message": "customer_id not exists",
+		})
+		c.Abort()
+		return
+	}
+
+	result = db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Delete(&models.Customer{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50084,
@@ -190,8 +272,119 @@ func DeleteCustomers(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.ActionDelete, audit.EntityCustomer, customerID, before, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "delete customer successfully",
 	})
 }
+
+type ReassignCustomersRequest struct {
+	FromPhone   string   `json:"from_phone" binding:"required"`
+	ToPhone     string   `json:"to_phone" binding:"required"`
+	CustomerIDs []string `json:"customer_ids"` // 为空时转移 from_phone 名下所有客户
+}
+
+func AdminReassignCustomers(c *gin.Context) {
+
+	var req ReassignCustomersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40085,
+			"message": "failed to bind reassign request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if len(req.FromPhone) != 11 || len(req.ToPhone) != 11 || req.FromPhone == req.ToPhone {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40086,
+			"message": "invalid from_phone or to_phone",
+		})
+		c.Abort()
+		return
+	}
+
+	// 原经纪人可能已经被删除
+	fromUser := models.NewUser()
+	result := db.DB.Table(consts.UserTable).Unscoped().Where("phone = ?", req.FromPhone).Limit(1).Find(fromUser)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50085,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40087,
+			"message": "from user not found",
+		})
+		c.Abort()
+		return
+	}
+
+	toUser := models.NewUser()
+	result = db.DB.Table(consts.UserTable).Where("phone = ?", req.ToPhone).Limit(1).Find(toUser)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50085,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40088,
+			"message": "to user not found",
+		})
+		c.Abort()
+		return
+	}
+
+	// 锁定要转移的客户, 避免与并发的转移或修改交错, 审计记录与实际更新的客户一致
+	var customerIDs []string
+	var affected int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Table 没有指定 Model, 需要手动排除已删除的客户
+		query := tx.Table(consts.CustomerTable).Where("user_id = ? AND deleted_at IS NULL", fromUser.ID)
+		if len(req.CustomerIDs) > 0 {
+			query = query.Where("customer_id IN ?", req.CustomerIDs)
+		}
+		if err := query.Clauses(clause.Locking{Strength: "UPDATE"}).Pluck("customer_id", &customerIDs).Error; err != nil {
+			return err
+		}
+		if len(customerIDs) == 0 {
+			return nil
+		}
+
+		result := tx.Table(consts.CustomerTable).Where("user_id = ? AND customer_id IN ? AND deleted_at IS NULL", fromUser.ID, customerIDs).Update("user_id", toUser.ID)
+		affected = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50086,
+			"message": "failed to reassign customers: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionReassign, audit.EntityCustomer, strings.Join(customerIDs, ","),
+		gin.H{"user_id": fromUser.ID, "phone": fromUser.Phone, "customer_ids": customerIDs},
+		gin.H{"user_id": toUser.ID, "phone": toUser.Phone, "customer_ids": customerIDs},
+	)
+
+	log.Printf("Reassign %d customers from %s to %s\n", affected, req.FromPhone, req.ToPhone)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":    20000,
+		"message":  "reassign customers successfully",
+		"affected": affected,
+	})
+}
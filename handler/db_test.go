@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 需要真实的 Postgres 的测试读取这个环境变量, 未设置时跳过, DSN 使用 key=value 格式, 见 README
+const testDSNEnv = "TEST_POSTGRES_DSN"
+
+// useTestDB 在 TEST_POSTGRES_DSN 指向的数据库中新建一个 schema 并建表, 把 db.DB 换成使用这个 schema 的连接
+// 返回的计数器统计之后执行的查询次数, 测试结束时删除 schema
+func useTestDB(tb testing.TB) *int64 {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		tb.Skip(testDSNEnv + " is not set, skipping test against Postgres")
+	}
+
+	config := &gorm.Config{Logger: logger.Discard}
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	schema := fmt.Sprintf("house_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		tb.Fatal(err)
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn+" search_path="+schema), config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	old := db.DB
+	tb.Cleanup(func() {
+		db.DB = old
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := conn.Table(consts.PropertyTable).AutoMigrate(&models.Property{}); err != nil {
+		tb.Fatal(err)
+	}
+	if err := conn.Table(consts.PropertyImageTable).AutoMigrate(&models.PropertyImage{}); err != nil {
+		tb.Fatal(err)
+	}
+
+	var queries int64
+	if err := conn.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) {
+		atomic.AddInt64(&queries, 1)
+	}); err != nil {
+		tb.Fatal(err)
+	}
+
+	db.DB = conn
+	return &queries
+}
+
+func createTestProperty(tb testing.TB, details string) uint {
+	property := models.Property{
+		Address: models.Address{Distinct: 110101, Details: details},
+		Status:  consts.PropertyStatusActive,
+	}
+	if err := db.DB.Table(consts.PropertyTable).Create(&property).Error; err != nil {
+		tb.Fatal(err)
+	}
+	return property.ID
+}
+
+// createTestImages 逐条插入, 保证 id 与切片顺序一致
+func createTestImages(tb testing.TB, images []models.PropertyImage) {
+	for i := range images {
+		if err := db.DB.Table(consts.PropertyImageTable).Create(&images[i]).Error; err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/shared/enum"
+	"net/http"
+)
+
+// 离散筛选项的列名和取值定义
+var valueFacetFields = []struct {
+	field  string
+	column string
+	enum   enum.Enum
+}{
+	{"room", "room", enum.Room},
+	{"direction", "direction", enum.Direction},
+	{"renovation", "renovation", enum.Renovation},
+	{"special", "special", enum.Special},
+	{"subjectmatter", "subjectmatter", enum.SubjectMatter},
+}
+
+// withoutFilter 去掉某个字段自身的筛选条件, 计数时只受其他已选条件影响
+func withoutFilter(req *SelectPropertiesRequest, field string) SelectPropertiesRequest {
+	others := *req
+	switch field {
+	case bucketFieldPrice:
+		others.Price, others.PriceRange = nil, nil
+	case bucketFieldSize:
+		others.Size, others.SizeRange = nil, nil
+	case bucketFieldHeight:
+		others.Height, others.HeightRange = nil, nil
+	case "room":
+		others.Room = nil
+	case "direction":
+		others.Direction = nil
+	case "renovation":
+		others.Renovation = nil
+	case "special":
+		others.Special = nil
+	case "subjectmatter":
+		others.SubjectMatter = nil
+	}
+	return others
+}
+
+type ValueFacet struct {
+	Value int    `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// valueFacets 按列分组计数, 返回枚举的每个取值, 没有房源的取值数量为 0
+func valueFacets(req *SelectPropertiesRequest, field string, column string, e enum.Enum, lang string) ([]ValueFacet, error) {
+	others := withoutFilter(req, field)
+
+	var rows []struct {
+		Value int
+		Count int64
+	}
+	query := applyPropertyFilters(db.DB.Table(consts.PropertyTable).Where("deleted_at IS NULL"), &others)
+	if err := query.Select(column + " AS value, COUNT(*) AS count").Group(column).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Value] = row.Count
+	}
+
+	facets := make([]ValueFacet, 0, e.Max())
+	for _, option := range e.Options {
+		facet := ValueFacet{Value: option.Value, Count: counts[option.Value]}
+		if lang != "" {
+			facet.Label = e.Label(option.Value, lang)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+// GetPropertyFacets 返回每个筛选项在其他已选条件下的房源数量
+func GetPropertyFacets(c *gin.Context) {
+	var req SelectPropertiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40250,
+			"message": "failed to bind SelectProperties Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40251,
+			"message": "invalid SelectProperties Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	results := gin.H{}
+	for _, field := range []string{bucketFieldPrice, bucketFieldSize, bucketFieldHeight} {
+		facets, err := bucketFacets(&req, field)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50250,
+				"message": "failed to count " + field + " facets: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		results[field] = facets
+	}
+	for _, f := range valueFacetFields {
+		facets, err := valueFacets(&req, f.field, f.column, f.enum, labelLang(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50250,
+				"message": "failed to count " + f.field + " facets: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		results[f.field] = facets
+	}
+
+	var total int64
+	if err := applyPropertyFilters(db.DB.Table(consts.PropertyTable).Where("deleted_at IS NULL"), &req).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50251,
+			"message": "failed to count properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "get property facets successfully",
+		"total":   total,
+		"results": results,
+	})
+}
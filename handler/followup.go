@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"net/http"
+	"time"
+)
+
+var followUpSortKeys = map[string]string{
+	"created_at":     "created_at",
+	"next_action_at": "next_action_at",
+}
+
+type CreateFollowUpRequest struct {
+	Type         string     `json:"type" binding:"required"`
+	Content      string     `json:"content"`
+	NextAction   string     `json:"next_action"`
+	NextActionAt *time.Time `json:"next_action_at"`
+}
+
+func (req *CreateFollowUpRequest) Validate() (bool, string) {
+	switch req.Type {
+	case consts.FollowUpCall, consts.FollowUpVisit, consts.FollowUpNote:
+	default:
+		return false, "跟进方式只能是 call, visit 或 note"
+	}
+	if req.Content == "" && req.NextAction == "" {
+		return false, "跟进内容和下一步计划不能同时为空"
+	}
+	if len(req.NextAction) > 255 {
+		return false, "下一步计划不能超过255个字符"
+	}
+	if req.NextActionAt != nil && req.NextAction == "" {
+		return false, "设置下一步时间时必须填写下一步计划"
+	}
+	return true, ""
+}
+
+func CreateFollowUp(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := loadCustomer(c, user, c.Param("customer_id"), true)
+	if !ok {
+		return
+	}
+
+	var req CreateFollowUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40200,
+			"message": "failed to bind CreateFollowUp Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40201,
+			"message": "invalid CreateFollowUp Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	followUp := models.CustomerFollowUp{
+		CustomerID:   customer.ID,
+		UserID:       user.ID,
+		Type:         req.Type,
+		Content:      req.Content,
+		NextAction:   req.NextAction,
+		NextActionAt: req.NextActionAt,
+	}
+	if err := db.DB.Table(consts.CustomerFollowUpTable).Create(&followUp).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50200,
+			"message": "failed to create follow-up: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionCreate, audit.EntityCustomer, customer.CustomerID, nil, followUp)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "create follow-up successfully",
+		"result":  followUp,
+	})
+}
+
+// ListFollowUps 客户的跟进时间线, 默认最新的在前
+func ListFollowUps(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := loadCustomer(c, user, c.Param("customer_id"), false)
+	if !ok {
+		return
+	}
+
+	p, err := page.Parse(c, followUpSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40202,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	followUps := make([]models.CustomerFollowUp, 0)
+	total, err := p.Find(db.DB.Table(consts.CustomerFollowUpTable).Where("customer_id = ?", customer.ID), &followUps)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50201,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "list follow-ups successfully",
+		"results":         followUps,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"github.com/hewo233/house-system-backend/utils/geo"
+	"gorm.io/gorm/clause"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	maxMapRadius = 50000 // 米
+	maxMapPins   = 500
+	// 缩放级别小于该值时返回聚合点
+	clusterZoom = 14
+)
+
+// 地图上只显示在售和已有意向的房源
+var mapStatuses = []string{consts.PropertyStatusActive, consts.PropertyStatusReserved}
+
+func validateCoordinate(lat *float64, lng *float64) (bool, string) {
+	if (lat == nil) != (lng == nil) {
+		return false, "经纬度必须同时填写"
+	}
+	if lat != nil && !geo.ValidCoordinate(*lat, *lng) {
+		return false, "经纬度超出范围"
+	}
+	return true, ""
+}
+
+// locateProperty 根据地址定位房源, 失败只记录日志
+func locateProperty(property *models.Property) {
+	address := division.FullName(property.Address.Distinct) + property.Address.Details
+	lat, lng, err := geo.Geocode(address, property.Address.Distinct)
+	if err != nil {
+		log.Println("failed to geocode "+address+": ", err)
+		return
+	}
+	property.Latitude = &lat
+	property.Longitude = &lng
+}
+
+type MapPin struct {
+	HouseID   uint     `json:"houseID"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Price     float64  `json:"price"`
+	Cover     string   `json:"cover"`
+	Distance  *float64 `json:"distance,omitempty"` // 米, 只有按半径搜索时返回
+}
+
+func toMapPins(properties []models.Property) ([]MapPin, error) {
+	ids := make([]uint, 0, len(properties))
+	for _, property := range properties {
+		ids = append(ids, property.ID)
+	}
+	covers, err := getPropertyCovers(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	pins := make([]MapPin, 0, len(properties))
+	for _, property := range properties {
+		cover := covers[property.ID]
+		if cover == "" {
+			cover = consts.DefaultImageUrl
+		}
+		pins = append(pins, MapPin{
+			HouseID:   property.ID,
+			Latitude:  *property.Latitude,
+			Longitude: *property.Longitude,
+			Price:     property.Price,
+			Cover:     cover,
+		})
+	}
+	return pins, nil
+}
+
+func parseFloatQuery(c *gin.Context, key string) (float64, bool) {
+	value, err := strconv.ParseFloat(c.Query(key), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40230,
+			"message": "invalid " + key + ": " + c.Query(key),
+		})
+		c.Abort()
+		return 0, false
+	}
+	return value, true
+}
+
+// queryPropertiesInBox 查询矩形范围内已定位的房源
+func queryPropertiesInBox(minLat, minLng, maxLat, maxLng float64, limit int, order interface{}) ([]models.Property, error) {
+	var properties []models.Property
+	err := db.DB.Table(consts.PropertyTable).
+		Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", minLat, maxLat, minLng, maxLng).
+		Where("status IN ?", mapStatuses).
+		Order(order).
+		Limit(limit).
+		Find(&properties).Error
+	return properties, err
+}
+
+// SearchPropertiesByRadius 按距离由近到远返回圆形范围内的房源
+func SearchPropertiesByRadius(c *gin.Context) {
+	lat, ok := parseFloatQuery(c, "lat")
+	if !ok {
+		return
+	}
+	lng, ok := parseFloatQuery(c, "lng")
+	if !ok {
+		return
+	}
+	radius, ok := parseFloatQuery(c, "radius")
+	if !ok {
+		return
+	}
+	if !geo.ValidCoordinate(lat, lng) || radius <= 0 || radius > maxMapRadius {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40231,
+			"message": "coordinate out of range or radius not in (0, 50000]",
+		})
+		c.Abort()
+		return
+	}
+
+	// 先用外接矩形走索引, 再精确计算距离
+	minLat, minLng, maxLat, maxLng := geo.BoundingBox(lat, lng, radius)
+	// 按近似距离排序, 经度差按纬度缩放
+	order := clause.OrderBy{Expression: clause.Expr{
+		SQL:                "power(latitude - ?, 2) + power((longitude - ?) * ?, 2)",
+		Vars:               []interface{}{lat, lng, math.Cos(lat * math.Pi / 180)},
+		WithoutParentheses: true,
+	}}
+	candidates, err := queryPropertiesInBox(minLat, minLng, maxLat, maxLng, maxMapPins*2, order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50230,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	distances := make(map[uint]float64, len(candidates))
+	properties := make([]models.Property, 0, len(candidates))
+	for _, property := range candidates {
+		d := geo.Distance(lat, lng, *property.Latitude, *property.Longitude)
+		if d <= radius {
+			distances[property.ID] = d
+			properties = append(properties, property)
+		}
+	}
+	sort.SliceStable(properties, func(i, j int) bool {
+		return distances[properties[i].ID] < distances[properties[j].ID]
+	})
+	if len(properties) > maxMapPins {
+		properties = properties[:maxMapPins]
+	}
+
+	pins, err := toMapPins(properties)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50231,
+			"message": "failed to query covers: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	for i := range pins {
+		d := distances[pins[i].HouseID]
+		pins[i].Distance = &d
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "search properties by radius successfully",
+		"results": pins,
+	})
+}
+
+type MapCluster struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+	Pin       *MapPin `json:"pin,omitempty"` // 只有一个房源时直接返回房源
+}
+
+// SearchPropertiesByBox 返回地图可视范围内的房源, 缩放级别较小或房源过多时按网格聚合
+func SearchPropertiesByBox(c *gin.Context) {
+	values := make(map[string]float64, 4)
+	for _, key := range []string{"min_lat", "min_lng", "max_lat", "max_lng"} {
+		value, ok := parseFloatQuery(c, key)
+		if !ok {
+			return
+		}
+		values[key] = value
+	}
+	minLat, minLng, maxLat, maxLng := values["min_lat"], values["min_lng"], values["max_lat"], values["max_lng"]
+	if !geo.ValidCoordinate(minLat, minLng) || !geo.ValidCoordinate(maxLat, maxLng) || minLat > maxLat || minLng > maxLng {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40232,
+			"message": "invalid bounding box",
+		})
+		c.Abort()
+		return
+	}
+
+	zoom := -1
+	if zoomStr := c.Query("zoom"); zoomStr != "" {
+		n, err := strconv.Atoi(zoomStr)
+		if err != nil || n < 0 || n > 22 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40233,
+				"message": "zoom must be in 0-22",
+			})
+			c.Abort()
+			return
+		}
+		zoom = n
+	}
+
+	var total int64
+	if err := db.DB.Table(consts.PropertyTable).
+		Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", minLat, maxLat, minLng, maxLng).
+		Where("status IN ? AND deleted_at IS NULL", mapStatuses).
+		Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50232,
+			"message": "failed to count properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if (zoom < 0 || zoom >= clusterZoom) && total <= maxMapPins {
+		properties, err := queryPropertiesInBox(minLat, minLng, maxLat, maxLng, maxMapPins, "id DESC")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50233,
+				"message": "failed to query properties: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		pins, err := toMapPins(properties)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50231,
+				"message": "failed to query covers: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"errno":     20000,
+			"message":   "search properties by box successfully",
+			"clustered": false,
+			"total":     total,
+			"results":   pins,
+		})
+		return
+	}
+
+	// 聚合只需要坐标, 不查询其他字段
+	var points []geo.Point
+	if err := db.DB.Table(consts.PropertyTable).
+		Select("id, latitude AS lat, longitude AS lng").
+		Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", minLat, maxLat, minLng, maxLng).
+		Where("status IN ? AND deleted_at IS NULL", mapStatuses).
+		Scan(&points).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50234,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	// 没有缩放级别时把可视范围横向分成 8 格
+	cellSize := (maxLng - minLng) / 8
+	if zoom >= 0 {
+		cellSize = geo.CellSize(zoom)
+	}
+	if cellSize <= 0 {
+		cellSize = geo.CellSize(clusterZoom)
+	}
+	clusters := geo.GridCluster(points, cellSize)
+
+	// 单个房源的聚合点直接返回房源信息
+	singleIDs := make([]uint, 0)
+	for _, cluster := range clusters {
+		if cluster.Count == 1 {
+			singleIDs = append(singleIDs, cluster.IDs[0])
+		}
+	}
+	var singles []models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id IN ?", singleIDs).Find(&singles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50233,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	pins, err := toMapPins(singles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50231,
+			"message": "failed to query covers: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	pinMap := make(map[uint]*MapPin, len(pins))
+	for i := range pins {
+		pinMap[pins[i].HouseID] = &pins[i]
+	}
+
+	results := make([]MapCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		item := MapCluster{
+			Latitude:  cluster.Lat,
+			Longitude: cluster.Lng,
+			Count:     cluster.Count,
+		}
+		if cluster.Count == 1 {
+			item.Pin = pinMap[cluster.IDs[0]]
+		}
+		results = append(results, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":     20000,
+		"message":   "search properties by box successfully",
+		"clustered": true,
+		"total":     total,
+		"results":   results,
+	})
+}
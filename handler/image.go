@@ -0,0 +1,484 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/OSS"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+var errImageNotFound = errors.New("image not found")
+
+// loadImageProperty 读取路径中的房源并检查修改权限
+func loadImageProperty(c *gin.Context) (*models.Property, bool) {
+	propertyID, err := strconv.ParseUint(c.Param("houseID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40270,
+			"message": "invalid property id",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	var property models.Property
+	result := db.DB.Table(consts.PropertyTable).Where("id = ?", propertyID).Limit(1).Find(&property)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50270,
+			"message": "failed to query property: " + result.Error.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40271,
+			"message": "property does not exist",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return nil, false
+	}
+	return &property, true
+}
+
+// loadPropertyImage 读取属于该房源的图片
+func loadPropertyImage(c *gin.Context, property *models.Property) (*models.PropertyImage, bool) {
+	imageID, err := strconv.ParseUint(c.Param("imageID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40272,
+			"message": "invalid image id",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	var image models.PropertyImage
+	result := db.DB.Table(consts.PropertyImageTable).Where("id = ? AND property_id = ?", imageID, property.ID).Limit(1).Find(&image)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50271,
+			"message": "failed to query image: " + result.Error.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40273,
+			"message": "image does not exist",
+		})
+		c.Abort()
+		return nil, false
+	}
+	return &image, true
+}
+
+func validImageLabels(caption, roomLabel *string) (bool, string) {
+	if caption != nil && utf8.RuneCountInString(*caption) > 200 {
+		return false, "图片说明不能超过200个字符"
+	}
+	if roomLabel != nil && utf8.RuneCountInString(*roomLabel) > 50 {
+		return false, "房间标签不能超过50个字符"
+	}
+	return true, ""
+}
+
+// lockPropertyImages 锁住房源行, 同一房源的图集修改串行执行
+func lockPropertyImages(tx *gorm.DB, propertyID uint) error {
+	return tx.Table(consts.PropertyTable).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", propertyID).First(&models.Property{}).Error
+}
+
+// setMainImage 把图集的主图换成 imageID
+func setMainImage(tx *gorm.DB, propertyID uint, imageID uint) error {
+	if err := tx.Table(consts.PropertyImageTable).Where("property_id = ? AND id <> ?", propertyID, imageID).Update("is_main", false).Error; err != nil {
+		return err
+	}
+	return tx.Table(consts.PropertyImageTable).Where("id = ?", imageID).Update("is_main", true).Error
+}
+
+// appendPropertyImage 把图片加到图集末尾, setMain 或图集没有主图时设为主图
+func appendPropertyImage(propertyID uint, image *models.PropertyImage, setMain bool) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPropertyImages(tx, propertyID); err != nil {
+			return err
+		}
+
+		// 上传真实图片后去掉占位的默认图片
+		if err := tx.Table(consts.PropertyImageTable).Where("property_id = ? AND url = ?", propertyID, consts.DefaultImageUrl).Delete(&models.PropertyImage{}).Error; err != nil {
+			return err
+		}
+
+		var stat struct {
+			MaxOrder *int
+			Mains    int64
+		}
+		if err := tx.Table(consts.PropertyImageTable).Where("property_id = ? AND deleted_at IS NULL", propertyID).
+			Select("MAX(sort_order) AS max_order, COUNT(*) FILTER (WHERE is_main) AS mains").Scan(&stat).Error; err != nil {
+			return err
+		}
+		if stat.MaxOrder != nil {
+			image.SortOrder = *stat.MaxOrder + 1
+		}
+
+		if err := tx.Table(consts.PropertyImageTable).Create(image).Error; err != nil {
+			return err
+		}
+
+		if setMain || stat.Mains == 0 {
+			image.IsMain = true
+			return setMainImage(tx, propertyID, image.ID)
+		}
+		return nil
+	})
+}
+
+func listPropertyImages(propertyID uint) ([]models.PropertyImage, error) {
+	images := make([]models.PropertyImage, 0)
+	err := db.DB.Table(consts.PropertyImageTable).Where("property_id = ?", propertyID).Order("sort_order, id").Find(&images).Error
+	return images, err
+}
+
+// AddPropertyImage 向图集末尾添加一张图片, is_main=true 或图集没有主图时设为主图
+func AddPropertyImage(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	property, ok := loadImageProperty(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40274,
+			"message": "image file is required: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	caption := c.PostForm("caption")
+	roomLabel := c.PostForm("room_label")
+	if ok, msg := validImageLabels(&caption, &roomLabel); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40275,
+			"message": "invalid image request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	urls, err := OSS.UploadImageToOSS(c, file)
+	if errors.Is(err, OSS.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40276,
+			"message": "invalid image " + file.Filename + ": " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50272,
+			"message": "failed to upload image: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	image := models.PropertyImage{
+		PropertyID:   property.ID,
+		URL:          urls.URL,
+		MediumURL:    urls.MediumURL,
+		ThumbnailURL: urls.ThumbnailURL,
+		Caption:      caption,
+		RoomLabel:    roomLabel,
+	}
+
+	if err := appendPropertyImage(property.ID, &image, c.PostForm("is_main") == "true"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50273,
+			"message": "failed to save image: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionCreate, audit.EntityPropertyImage, property.ID, nil, image)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "add image successfully",
+		"image":   image,
+	})
+}
+
+// DeletePropertyImage 删除单张图片, 删除的是主图时由排在最前的图片接替
+// OSS 上的文件不在这里删除, 由孤儿文件清理处理
+func DeletePropertyImage(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	property, ok := loadImageProperty(c)
+	if !ok {
+		return
+	}
+
+	image, ok := loadPropertyImage(c, property)
+	if !ok {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPropertyImages(tx, property.ID); err != nil {
+			return err
+		}
+
+		result := tx.Table(consts.PropertyImageTable).Where("id = ?", image.ID).Delete(&models.PropertyImage{})
+		if result.Error != nil {
+			return result.Error
+		}
+		// 并发删除时已经被删掉
+		if result.RowsAffected == 0 {
+			return errImageNotFound
+		}
+
+		if !image.IsMain {
+			return nil
+		}
+		var next models.PropertyImage
+		found := tx.Table(consts.PropertyImageTable).Where("property_id = ?", property.ID).Order("sort_order, id").Limit(1).Find(&next)
+		if found.Error != nil || found.RowsAffected == 0 {
+			return found.Error
+		}
+		return setMainImage(tx, property.ID, next.ID)
+	})
+	if errors.Is(err, errImageNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40273,
+			"message": "image does not exist",
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50274,
+			"message": "failed to delete image: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionDelete, audit.EntityPropertyImage, property.ID, image, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "delete image successfully",
+	})
+}
+
+type ModifyPropertyImageInfoRequest struct {
+	Caption   *string `json:"caption"`
+	RoomLabel *string `json:"room_label"`
+	IsMain    *bool   `json:"is_main"` // 只能设为 true, 取消主图请把其他图片设为主图
+}
+
+func (req *ModifyPropertyImageInfoRequest) Validate() (bool, string) {
+	if req.IsMain != nil && !*req.IsMain {
+		return false, "不能取消主图, 请把其他图片设为主图"
+	}
+	return validImageLabels(req.Caption, req.RoomLabel)
+}
+
+// ModifyPropertyImageInfo 修改图片说明、房间标签, 或设为封面
+func ModifyPropertyImageInfo(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	property, ok := loadImageProperty(c)
+	if !ok {
+		return
+	}
+
+	image, ok := loadPropertyImage(c, property)
+	if !ok {
+		return
+	}
+
+	var req ModifyPropertyImageInfoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40277,
+			"message": "failed to bind request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40278,
+			"message": "invalid ModifyPropertyImageInfo Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	before := *image
+	updates := map[string]interface{}{}
+	if req.Caption != nil {
+		updates["caption"] = *req.Caption
+		image.Caption = *req.Caption
+	}
+	if req.RoomLabel != nil {
+		updates["room_label"] = *req.RoomLabel
+		image.RoomLabel = *req.RoomLabel
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Table(consts.PropertyImageTable).Where("id = ?", image.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if req.IsMain != nil && !image.IsMain {
+			if err := lockPropertyImages(tx, property.ID); err != nil {
+				return err
+			}
+			image.IsMain = true
+			return setMainImage(tx, property.ID, image.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50275,
+			"message": "failed to update image: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionUpdate, audit.EntityPropertyImage, property.ID, before, *image)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "update image successfully",
+		"image":   image,
+	})
+}
+
+type ReorderPropertyImagesRequest struct {
+	ImageIDs []uint `json:"image_ids" binding:"required"` // 图集中所有图片的新顺序
+}
+
+// ReorderPropertyImages 按请求中的顺序重排图集, 必须包含该房源的所有图片
+func ReorderPropertyImages(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	property, ok := loadImageProperty(c)
+	if !ok {
+		return
+	}
+
+	var req ReorderPropertyImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40400,
+			"message": "failed to bind request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var mismatch bool
+	var ids []uint
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPropertyImages(tx, property.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Table(consts.PropertyImageTable).Where("property_id = ? AND deleted_at IS NULL", property.ID).Order("sort_order, id").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		existing := make(map[uint]bool, len(ids))
+		for _, id := range ids {
+			existing[id] = true
+		}
+		if len(req.ImageIDs) != len(ids) {
+			mismatch = true
+			return nil
+		}
+		for _, id := range req.ImageIDs {
+			if !existing[id] {
+				mismatch = true
+				return nil
+			}
+			// 重复的 id 也算不匹配
+			delete(existing, id)
+		}
+
+		for i, id := range req.ImageIDs {
+			if err := tx.Table(consts.PropertyImageTable).Where("id = ?", id).Update("sort_order", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50400,
+			"message": "failed to reorder images: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if mismatch {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40401,
+			"message": "image_ids must contain every image of the property exactly once",
+		})
+		c.Abort()
+		return
+	}
+
+	images, err := listPropertyImages(property.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50401,
+			"message": "failed to query images: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionUpdate, audit.EntityPropertyImage, property.ID, gin.H{"order": ids}, gin.H{"order": req.ImageIDs})
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "reorder images successfully",
+		"images":  images,
+	})
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"crypto/rand"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"github.com/hewo233/house-system-backend/utils/rbac"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const inviteCodeCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var inviteCodeSortKeys = map[string]string{
+	"created_at": "created_at",
+	"expires_at": "expires_at",
+	"used_count": "used_count",
+}
+
+func generateInviteCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteCodeCharset))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = inviteCodeCharset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// validInviteRole 邀请码不能直接生成管理员, 管理员只能由已有管理员分配
+func validInviteRole(role string) bool {
+	return rbac.ValidRole(role) && role != consts.RoleAdmin
+}
+
+// checkInviteCodeUsable 检查邀请码是否被撤销、过期或用完
+func checkInviteCodeUsable(inviteCode *models.InviteCode) (bool, string) {
+	// 兼容修复前创建的管理员邀请码
+	if inviteCode.Role == consts.RoleAdmin {
+		return false, "invite code cannot grant the admin role"
+	}
+	if inviteCode.Revoked {
+		return false, "invite code has been revoked"
+	}
+	if inviteCode.ExpiresAt != nil && time.Now().After(*inviteCode.ExpiresAt) {
+		return false, "invite code has expired"
+	}
+	if inviteCode.MaxUses > 0 && inviteCode.UsedCount >= inviteCode.MaxUses {
+		return false, "invite code has been used up"
+	}
+	return true, ""
+}
+
+type CreateInviteCodeRequest struct {
+	Code      string     `json:"code"`       // 为空时自动生成
+	ExpiresAt *time.Time `json:"expires_at"` // 为空表示永不过期
+	MaxUses   int        `json:"max_uses"`   // 0 表示不限次数
+	Role      string     `json:"role"`
+	Team      string     `json:"team"`
+}
+
+func (req *CreateInviteCodeRequest) Validate() (bool, string) {
+	if req.Code != "" && (len(req.Code) < 6 || len(req.Code) > 32) {
+		return false, "邀请码长度必须在6-32之间"
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return false, "过期时间必须晚于当前时间"
+	}
+	if req.MaxUses < 0 {
+		return false, "使用次数不能小于0"
+	}
+	if req.Role != "" && !validInviteRole(req.Role) {
+		return false, "角色不存在或不能通过邀请码分配"
+	}
+	if len(req.Team) > 50 {
+		return false, "团队名称不能超过50个字符"
+	}
+	return true, ""
+}
+
+func AdminCreateInviteCode(c *gin.Context) {
+	var req CreateInviteCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40120,
+			"message": "failed to bind request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40121,
+			"message": "invalid CreateInviteCode Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	code := req.Code
+	if code == "" {
+		var err error
+		code, err = generateInviteCode(8)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50120,
+				"message": "failed to generate invite code: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+	}
+
+	result := db.DB.Table(consts.InviteCodeTable).Unscoped().Where("code = ?", code).Limit(1).Find(&models.InviteCode{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50121,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40122,
+			"message": "invite code already exists",
+		})
+		c.Abort()
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = consts.RoleAgent
+	}
+
+	inviteCode := models.InviteCode{
+		Code:      code,
+		ExpiresAt: req.ExpiresAt,
+		MaxUses:   req.MaxUses,
+		Role:      role,
+		Team:      req.Team,
+		CreatedBy: c.GetString("phone"),
+	}
+	if err := db.DB.Table(consts.InviteCodeTable).Create(&inviteCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50122,
+			"message": "failed to create invite code: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionCreate, audit.EntityInviteCode, inviteCode.Code, nil, inviteCode)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "create invite code successfully",
+		"result":  inviteCode,
+	})
+}
+
+func AdminListInviteCodes(c *gin.Context) {
+	p, err := page.Parse(c, inviteCodeSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40123,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	query := db.DB.Table(consts.InviteCodeTable)
+	if c.Query("usable") == "true" {
+		query = query.Where("revoked = ? AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR used_count < max_uses)", false, time.Now())
+	}
+
+	inviteCodes := make([]models.InviteCode, 0)
+	total, err := p.Find(query, &inviteCodes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50123,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "list invite codes successfully",
+		"results":         inviteCodes,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
+
+func AdminRevokeInviteCode(c *gin.Context) {
+	code := c.Param("code")
+	result := db.DB.Table(consts.InviteCodeTable).Where("code = ?", code).Update("revoked", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50124,
+			"message": "failed to revoke invite code: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40124,
+			"message": "invite code not found",
+		})
+		c.Abort()
+		return
+	}
+
+	log.Println("Revoke invite code: ", code)
+	audit.Record(c, audit.ActionRevoke, audit.EntityInviteCode, code, gin.H{"revoked": false}, gin.H{"revoked": true})
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "revoke invite code successfully",
+	})
+}
+
+// AdminListInviteRedemptions 查看邀请码被哪些用户使用, 可按 code 筛选
+func AdminListInviteRedemptions(c *gin.Context) {
+	p, err := page.Parse(c, map[string]string{"created_at": "created_at"}, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40125,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	query := db.DB.Table(consts.InviteRedemptionTable)
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code = ?", code)
+	}
+
+	redemptions := make([]models.InviteRedemption, 0)
+	total, err := p.Find(query, &redemptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50125,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "list invite redemptions successfully",
+		"results":         redemptions,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
@@ -0,0 +1,572 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"github.com/hewo233/house-system-backend/utils/rbac"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 各项需求的权重, 地区和预算是硬性条件, 其余只影响排序
+const (
+	matchWeightDistrict   = 3
+	matchWeightPrice      = 3
+	matchWeightSize       = 2
+	matchWeightRoom       = 2
+	matchWeightRenovation = 1
+	matchWeightHeight     = 1
+)
+
+var matchSortKeys = map[string]string{
+	"score": "score",
+}
+
+type CustomerRequirementRequest struct {
+	Districts  []int `json:"districts"`
+	Price      []int `json:"price"`
+	Size       []int `json:"size"`
+	Room       []int `json:"room"`
+	Renovation []int `json:"renovation"`
+	Height     []int `json:"height"`
+}
+
+func (req *CustomerRequirementRequest) Validate() (bool, string) {
+	for _, district := range req.Districts {
+		if ok, msg := division.ValidateRegion(district); !ok {
+			return false, msg
+		}
+	}
+
+	// 区间取值与房源筛选一致
+	selectReq := SelectPropertiesRequest{
+		Price:      req.Price,
+		Size:       req.Size,
+		Room:       req.Room,
+		Renovation: req.Renovation,
+		Height:     req.Height,
+	}
+	if ok, msg := selectReq.Validate(); !ok {
+		return false, msg
+	}
+
+	if len(req.Districts)+len(req.Price)+len(req.Size)+len(req.Room)+len(req.Renovation)+len(req.Height) == 0 {
+		return false, "至少需要填写一项需求"
+	}
+
+	return true, ""
+}
+
+// districtMatches 编码以 0000 结尾表示整个省, 以 00 结尾表示整个市
+func districtMatches(want int, distinct int) bool {
+	switch {
+	case want%10000 == 0:
+		return distinct/10000 == want/10000
+	case want%100 == 0:
+		return distinct/100 == want/100
+	default:
+		return distinct == want
+	}
+}
+
+func districtCondition(want int) (string, []interface{}) {
+	switch {
+	case want%10000 == 0:
+		return "(\"distinct\" >= ? AND \"distinct\" < ?)", []interface{}{want, want + 10000}
+	case want%100 == 0:
+		return "(\"distinct\" >= ? AND \"distinct\" < ?)", []interface{}{want, want + 100}
+	default:
+		return "\"distinct\" = ?", []interface{}{want}
+	}
+}
+
+func intIn(value int, values []int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hardMatch 地区和预算必须满足
+func hardMatch(req *models.CustomerRequirement, property *models.Property) bool {
+	if len(req.Districts) > 0 {
+		matched := false
+		for _, district := range req.Districts {
+			if districtMatches(district, property.Address.Distinct) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(req.Price) > 0 && !inBuckets(property.Price, bucketFieldPrice, req.Price) {
+		return false
+	}
+	return true
+}
+
+// scoreProperty 返回 0-100 的匹配分数和满足的需求项
+func scoreProperty(req *models.CustomerRequirement, property *models.Property) (int, []string) {
+	total, score := 0, 0
+	matched := make([]string, 0)
+
+	check := func(name string, weight int, specified bool, ok bool) {
+		if !specified {
+			return
+		}
+		total += weight
+		if ok {
+			score += weight
+			matched = append(matched, name)
+		}
+	}
+
+	districtOK := false
+	for _, district := range req.Districts {
+		if districtMatches(district, property.Address.Distinct) {
+			districtOK = true
+			break
+		}
+	}
+	check("districts", matchWeightDistrict, len(req.Districts) > 0, districtOK)
+	check("price", matchWeightPrice, len(req.Price) > 0, inBuckets(property.Price, bucketFieldPrice, req.Price))
+	check("size", matchWeightSize, len(req.Size) > 0, inBuckets(property.Size, bucketFieldSize, req.Size))
+	check("room", matchWeightRoom, len(req.Room) > 0, intIn(property.Room, req.Room))
+	check("renovation", matchWeightRenovation, len(req.Renovation) > 0, intIn(property.Renovation, req.Renovation))
+	check("height", matchWeightHeight, len(req.Height) > 0, inBuckets(float64(property.Height), bucketFieldHeight, req.Height))
+
+	if total == 0 {
+		return 0, matched
+	}
+	return score * 100 / total, matched
+}
+
+// pageRange 对已经排好序的结果分页
+func pageRange(p *page.Page, length int) (int, int) {
+	start := p.Offset()
+	if start > length {
+		start = length
+	}
+	end := start + p.PageSize
+	if end > length {
+		end = length
+	}
+	return start, end
+}
+
+// loadCustomer 按 customer_id 查询客户, write 为 true 时只允许归属经纪人或有 customer:manage 权限的用户
+func loadCustomer(c *gin.Context, user *models.User, customerID string, write bool) (*models.Customer, bool) {
+	customer := models.NewCustomer()
+	result := db.DB.Table(consts.CustomerTable).Where("customer_id = ?", customerID).Limit(1).Find(customer)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50170,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40170,
+			"message": "customer_id not exists",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	if write && customer.UserID != user.ID && !rbac.HasPermission(user.Role, consts.PermCustomerManage) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"errno":   40370,
+			"message": "Forbidden, only the owner or manager can modify this customer",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	return customer, true
+}
+
+func SetCustomerRequirement(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := loadCustomer(c, user, c.Param("customer_id"), true)
+	if !ok {
+		return
+	}
+
+	var req CustomerRequirementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40171,
+			"message": "failed to bind CustomerRequirement Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40172,
+			"message": "invalid CustomerRequirement Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	requirement := models.NewCustomerRequirement()
+	result := db.DB.Table(consts.CustomerRequirementTable).Where("customer_id = ?", customer.ID).Limit(1).Find(requirement)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50171,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	before := *requirement
+
+	requirement.CustomerID = customer.ID
+	requirement.Districts = req.Districts
+	requirement.Price = req.Price
+	requirement.Size = req.Size
+	requirement.Room = req.Room
+	requirement.Renovation = req.Renovation
+	requirement.Height = req.Height
+
+	if err := db.DB.Table(consts.CustomerRequirementTable).Save(requirement).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50172,
+			"message": "failed to save customer requirement: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		audit.Record(c, audit.ActionCreate, audit.EntityCustomer, customer.CustomerID, nil, requirement)
+	} else {
+		audit.Record(c, audit.ActionUpdate, audit.EntityCustomer, customer.CustomerID, before, requirement)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "save customer requirement successfully",
+		"result":  requirement,
+	})
+}
+
+func GetCustomerRequirement(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := loadCustomer(c, user, c.Param("customer_id"), false)
+	if !ok {
+		return
+	}
+
+	requirement := models.NewCustomerRequirement()
+	result := db.DB.Table(consts.CustomerRequirementTable).Where("customer_id = ?", customer.ID).Limit(1).Find(requirement)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50173,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40173,
+			"message": "customer has no requirement",
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "get customer requirement successfully",
+		"result":  requirement,
+	})
+}
+
+type MatchPropertyResponse struct {
+	ListPropertyResponse
+	Score   int      `json:"score"`
+	Matched []string `json:"matched"`
+}
+
+// MatchPropertiesForCustomer 按匹配度返回满足客户需求的在售房源
+func MatchPropertiesForCustomer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := loadCustomer(c, user, c.Param("customer_id"), false)
+	if !ok {
+		return
+	}
+
+	p, err := page.Parse(c, matchSortKeys, "score")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40174,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	requirement := models.NewCustomerRequirement()
+	result := db.DB.Table(consts.CustomerRequirementTable).Where("customer_id = ?", customer.ID).Limit(1).Find(requirement)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50174,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40173,
+			"message": "customer has no requirement",
+		})
+		c.Abort()
+		return
+	}
+
+	// 预算和状态复用房源筛选条件, 地区支持多个省、市、区县
+	query := applyPropertyFilters(db.DB.Table(consts.PropertyTable), &SelectPropertiesRequest{
+		Price:  requirement.Price,
+		Status: []string{consts.PropertyStatusActive, consts.PropertyStatusReserved},
+	})
+	if len(requirement.Districts) > 0 {
+		conditions := make([]string, 0, len(requirement.Districts))
+		args := make([]interface{}, 0, len(requirement.Districts))
+		for _, district := range requirement.Districts {
+			condition, conditionArgs := districtCondition(district)
+			conditions = append(conditions, condition)
+			args = append(args, conditionArgs...)
+		}
+		query = query.Where(strings.Join(conditions, " OR "), args...)
+	}
+
+	// 所有满足硬性条件的房源都参与打分, 只查询打分用到的列, 排序后再取当前页的完整信息
+	var properties []models.Property
+	if err := query.Select("id", "distinct", "price", "size", "room", "renovation", "height").
+		Order("id DESC").Find(&properties).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50175,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	type scored struct {
+		propertyID uint
+		score      int
+		matched    []string
+	}
+	candidates := make([]scored, 0, len(properties))
+	for _, property := range properties {
+		score, matched := scoreProperty(requirement, &property)
+		candidates = append(candidates, scored{propertyID: property.ID, score: score, matched: matched})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if p.Desc {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].score < candidates[j].score
+	})
+
+	total := int64(len(candidates))
+	start, end := pageRange(p, len(candidates))
+
+	propertyIDs := make([]uint, 0, end-start)
+	for _, candidate := range candidates[start:end] {
+		propertyIDs = append(propertyIDs, candidate.propertyID)
+	}
+
+	var found []models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id IN ?", propertyIDs).Find(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50175,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	propertyMap := make(map[uint]models.Property, len(found))
+	for _, property := range found {
+		propertyMap[property.ID] = property
+	}
+
+	// 按分数顺序排列当前页, 打分后被删除的房源跳过
+	pageProperties := make([]models.Property, 0, end-start)
+	pageCandidates := make([]scored, 0, end-start)
+	for _, candidate := range candidates[start:end] {
+		property, ok := propertyMap[candidate.propertyID]
+		if !ok {
+			continue
+		}
+		pageProperties = append(pageProperties, property)
+		pageCandidates = append(pageCandidates, candidate)
+	}
+
+	list, ok := getListResponseByProperties(c, pageProperties)
+	if !ok {
+		return
+	}
+
+	response := make([]MatchPropertyResponse, 0, len(list))
+	for i, item := range list {
+		response = append(response, MatchPropertyResponse{
+			ListPropertyResponse: item,
+			Score:                pageCandidates[i].score,
+			Matched:              pageCandidates[i].matched,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "successfully match properties for customer",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
+
+type MatchCustomerResponse struct {
+	Customer models.Customer `json:"customer"`
+	Score    int             `json:"score"`
+	Matched  []string        `json:"matched"`
+}
+
+// MatchCustomersForProperty 按匹配度返回可能对房源感兴趣的客户
+func MatchCustomersForProperty(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var property models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id=?", c.Param("houseID")).First(&property).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40175,
+			"message": "property does not exist: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	// 已售、下架、草稿等状态的房源不再推荐给客户
+	if property.Status != consts.PropertyStatusActive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40176,
+			"message": "property is not active, status: " + property.Status,
+		})
+		c.Abort()
+		return
+	}
+
+	p, err := page.Parse(c, matchSortKeys, "score")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40174,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	// 只匹配未删除的客户
+	var requirements []models.CustomerRequirement
+	if err := db.DB.Table(consts.CustomerRequirementTable).
+		Where("customer_id IN (?)", db.DB.Table(consts.CustomerTable).Select("id").Where("deleted_at IS NULL")).
+		Find(&requirements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50176,
+			"message": "failed to query customer requirements: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	type scored struct {
+		customerID uint
+		score      int
+		matched    []string
+	}
+	candidates := make([]scored, 0)
+	for i := range requirements {
+		if !hardMatch(&requirements[i], &property) {
+			continue
+		}
+		score, matched := scoreProperty(&requirements[i], &property)
+		candidates = append(candidates, scored{customerID: requirements[i].CustomerID, score: score, matched: matched})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if p.Desc {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].score < candidates[j].score
+	})
+
+	total := int64(len(candidates))
+	start, end := pageRange(p, len(candidates))
+
+	customerIDs := make([]uint, 0, end-start)
+	for _, candidate := range candidates[start:end] {
+		customerIDs = append(customerIDs, candidate.customerID)
+	}
+
+	var customers []models.Customer
+	if err := db.DB.Table(consts.CustomerTable).Where("id IN ?", customerIDs).Find(&customers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50177,
+			"message": "failed to query customers: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	customerMap := make(map[uint]models.Customer, len(customers))
+	for _, customer := range customers {
+		maskCustomerPhone(user, &customer)
+		customerMap[customer.ID] = customer
+	}
+
+	response := make([]MatchCustomerResponse, 0, end-start)
+	for _, candidate := range candidates[start:end] {
+		response = append(response, MatchCustomerResponse{
+			Customer: customerMap[candidate.customerID],
+			Score:    candidate.score,
+			Matched:  candidate.matched,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "successfully match customers for property",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
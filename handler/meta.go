@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/enum"
+	"net/http"
+)
+
+func validEnum(e enum.Enum, value int) (bool, string) {
+	if !e.Valid(value) {
+		return false, fmt.Sprintf("%s必须在1-%d范围内", e.Name, e.Max())
+	}
+	return true, ""
+}
+
+// validEnumFilter 筛选值允许为 0, 与之前的行为一致
+func validEnumFilter(e enum.Enum, values []int) (bool, string) {
+	for _, value := range values {
+		if value != 0 && !e.Valid(value) {
+			return false, fmt.Sprintf("%s筛选值必须在0-%d范围内", e.Name, e.Max())
+		}
+	}
+	return true, ""
+}
+
+// labelLang 读取 lang 参数, 未传或不支持时返回空字符串, 响应中不附带名称
+func labelLang(c *gin.Context) string {
+	switch lang := c.Query("lang"); lang {
+	case enum.LangZh, enum.LangEn:
+		return lang
+	}
+	return ""
+}
+
+// propertyLabels 房源编码字段对应的名称, lang 为空时返回 nil
+func propertyLabels(property *models.Property, lang string) map[string]string {
+	if lang == "" {
+		return nil
+	}
+	return map[string]string{
+		"direction":     enum.Direction.Label(property.Direction, lang),
+		"renovation":    enum.Renovation.Label(property.Renovation, lang),
+		"room":          enum.Room.Label(property.Room, lang),
+		"special":       enum.Special.Label(property.Special, lang),
+		"subjectmatter": enum.SubjectMatter.Label(property.SubjectMatter, lang),
+	}
+}
+
+// ListEnums 返回房源编码字段的所有取值和中英文名称, name 参数只返回单个字段
+func ListEnums(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"errno":   20000,
+			"message": "list enums successfully",
+			"results": enum.All,
+		})
+		return
+	}
+
+	e, ok := enum.All[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40260,
+			"message": "enum not found: " + name,
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "list enums successfully",
+		"results": gin.H{name: e},
+	})
+}
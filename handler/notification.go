@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"net/http"
+	"time"
+)
+
+var notificationSortKeys = map[string]string{
+	"created_at": "created_at",
+}
+
+// ListNotifications 查看自己的站内通知, unread=true 时只返回未读
+func ListNotifications(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	p, err := page.Parse(c, notificationSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40190,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	query := db.DB.Table(consts.NotificationTable).Where("user_id = ?", user.ID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	notifications := make([]models.Notification, 0)
+	total, err := p.Find(query, &notifications)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50190,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var unread int64
+	if err := db.DB.Table(consts.NotificationTable).Where("user_id = ? AND read_at IS NULL AND deleted_at IS NULL", user.ID).Count(&unread).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50191,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "list notifications successfully",
+		"results":         notifications,
+		"unread":          unread,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
+
+func ReadNotification(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	result := db.DB.Table(consts.NotificationTable).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Param("id"), user.ID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50192,
+			"message": "failed to update notification: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40191,
+			"message": "notification not found or already read",
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "read notification successfully",
+	})
+}
+
+func ReadAllNotifications(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	result := db.DB.Table(consts.NotificationTable).
+		Where("user_id = ? AND read_at IS NULL", user.ID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50193,
+			"message": "failed to update notifications: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "read all notifications successfully",
+		"count":   result.RowsAffected,
+	})
+}
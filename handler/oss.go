@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/OSS"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// 同一时间只允许一个删除任务
+var ossGCRunning atomic.Bool
+
+// AdminCollectOSSGarbage 清理没有被房源引用的 OSS 文件
+// dry_run 默认为 true, 只返回报告; dry_run=false 时在后台删除, 结果写入日志
+// grace 为宽限期, 如 72h, 默认 3 天
+func AdminCollectOSSGarbage(c *gin.Context) {
+	grace := consts.ThreeDays
+	if value := c.Query("grace"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < consts.OSSGCMinGrace {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40290,
+				"message": "grace should be a duration of at least " + consts.OSSGCMinGrace.String(),
+			})
+			c.Abort()
+			return
+		}
+		grace = parsed
+	}
+	dryRun := c.Query("dry_run") != "false"
+
+	refs, err := OSS.ReferencedURLs(db.DB, time.Now().Add(-grace))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50290,
+			"message": "failed to query referenced files: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	// 配置不对时直接返回错误, 不要等到后台任务里才发现
+	if _, err := refs.Keys(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50292,
+			"message": "refuse to collect garbage: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	opts := OSS.GCOptions{GracePeriod: grace, DryRun: dryRun}
+	if dryRun {
+		report, err := OSS.CollectGarbage(c, refs, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50291,
+				"message": "failed to collect garbage: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"errno":   20000,
+			"message": "collect oss garbage successfully",
+			"result":  report,
+		})
+		return
+	}
+
+	if !ossGCRunning.CompareAndSwap(false, true) {
+		c.JSON(http.StatusConflict, gin.H{
+			"errno":   40990,
+			"message": "oss garbage collection is already running",
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionDelete, audit.EntityOSSObject, consts.OSSRootUrl, nil, gin.H{
+		"grace_period": grace.String(),
+	})
+
+	// 删除可能要很久, 不占用请求, 也不随请求取消
+	go func() {
+		defer ossGCRunning.Store(false)
+		report, err := OSS.CollectGarbage(context.Background(), refs, opts)
+		if err != nil {
+			log.Println("failed to collect oss garbage: ", err)
+			return
+		}
+		log.Printf("oss garbage collection finished, deleted %d of %d orphans (%d bytes), %d errors\n",
+			report.Deleted, report.OrphanCount, report.OrphanBytes, len(report.Errors))
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"errno":   20000,
+		"message": "oss garbage collection started, check the server log for the result",
+	})
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type PriceHistoryItem struct {
+	OldPrice  float64       `json:"oldPrice"`
+	Price     float64       `json:"price"`
+	ChangedAt string        `json:"changedAt"`
+	ChangedBy PropertyAgent `json:"changedBy"`
+}
+
+// getPriceHistory 按时间顺序返回房源的价格变化
+func getPriceHistory(propertyID uint) ([]PriceHistoryItem, error) {
+	var histories []models.PropertyPriceHistory
+	if err := db.DB.Table(consts.PropertyPriceHistoryTable).Where("property_id = ?", propertyID).Order("created_at, id").Find(&histories).Error; err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]uint, 0, len(histories))
+	for _, history := range histories {
+		userIDs = append(userIDs, history.UserID)
+	}
+	agents, err := getPropertyAgents(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]PriceHistoryItem, 0, len(histories))
+	for _, history := range histories {
+		items = append(items, PriceHistoryItem{
+			OldPrice:  history.OldPrice,
+			Price:     history.Price,
+			ChangedAt: history.CreatedAt.Format("2006-01-02 15:04:05"),
+			ChangedBy: agents[history.UserID],
+		})
+	}
+
+	return items, nil
+}
+
+type PriceDropResponse struct {
+	ListPropertyResponse
+	PreviousPrice float64 `json:"previousPrice"` // 统计区间开始时的价格
+	DropAmount    float64 `json:"dropAmount"`
+	LastDropTime  string  `json:"lastDropTime"`
+}
+
+// ListPriceDrops 在售房源中当前价格低于 days 天前价格的房源, 方便经纪人联系意向客户
+// days 天前的价格取区间内第一条调价记录的原价, 降价后又涨回去的房源不返回
+func ListPriceDrops(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40410,
+			"message": "days must be in 1-365",
+		})
+		c.Abort()
+		return
+	}
+
+	p, err := page.Parse(c, propertySortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40411,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(days) * consts.OneDay)
+	// 首次定价的记录 old_price 为 0, 不作为参考价
+	previousPrice := fmt.Sprintf("(SELECT h.old_price FROM %s AS h WHERE h.property_id = %s.id AND h.created_at >= ? AND h.old_price > 0 AND h.deleted_at IS NULL ORDER BY h.created_at, h.id LIMIT 1)",
+		consts.PropertyPriceHistoryTable, consts.PropertyTable)
+
+	var properties []models.Property
+	query := db.DB.Table(consts.PropertyTable).Where("status = ? AND price < "+previousPrice, consts.PropertyStatusActive, since)
+	total, err := p.Find(query, &properties)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50410,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	propertyIDs := make([]uint, 0, len(properties))
+	for _, property := range properties {
+		propertyIDs = append(propertyIDs, property.ID)
+	}
+
+	var histories []models.PropertyPriceHistory
+	if err := db.DB.Table(consts.PropertyPriceHistoryTable).
+		Where("property_id IN ? AND created_at >= ? AND old_price > 0", propertyIDs, since).
+		Order("created_at, id").Find(&histories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50411,
+			"message": "failed to query price history: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	previousPrices := make(map[uint]float64)
+	lastDrops := make(map[uint]time.Time)
+	for _, history := range histories {
+		if _, ok := previousPrices[history.PropertyID]; !ok {
+			previousPrices[history.PropertyID] = history.OldPrice
+		}
+		if history.Price < history.OldPrice {
+			lastDrops[history.PropertyID] = history.CreatedAt
+		}
+	}
+
+	list, ok := getListResponseByProperties(c, properties)
+	if !ok {
+		return
+	}
+
+	response := make([]PriceDropResponse, 0, len(list))
+	for _, item := range list {
+		previous := previousPrices[item.HouseID]
+		response = append(response, PriceDropResponse{
+			ListPropertyResponse: item,
+			PreviousPrice:        previous,
+			DropAmount:           previous - item.Price,
+			LastDropTime:         lastDrops[item.HouseID].Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "successfully get price drop properties",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
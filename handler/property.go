@@ -1,17 +1,27 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/hewo233/house-system-backend/db"
 	"github.com/hewo233/house-system-backend/models"
 	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/shared/enum"
 	"github.com/hewo233/house-system-backend/utils/OSS"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"github.com/hewo233/house-system-backend/utils/rbac"
+	"github.com/hewo233/house-system-backend/utils/search"
 	"github.com/jinzhu/copier"
-	"math"
+	"gorm.io/gorm"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type CreatePropertyBaseInfoRequest struct {
@@ -19,21 +29,24 @@ type CreatePropertyBaseInfoRequest struct {
 		Distinct int    `json:"distinct" binding:"required"`
 		Details  string `json:"details" binding:"required"`
 	} `json:"address" binding:"required"`
-	Direction     int     `json:"direction" binding:"required"`
-	Height        int     `json:"height" binding:"required"`
-	TotalHeight   int     `json:"totalHeight" binding:"required"`
-	Price         float64 `json:"price" binding:"required"`
-	Renovation    int     `json:"renovation" binding:"required"`
-	Room          int     `json:"room" binding:"required"`
-	Size          float64 `json:"size" binding:"required"`
-	Special       int     `json:"special" binding:"required"`
-	SubjectMatter int     `json:"subjectmatter" binding:"required"`
+	Direction     int      `json:"direction" binding:"required"`
+	Height        int      `json:"height" binding:"required"`
+	TotalHeight   int      `json:"totalHeight" binding:"required"`
+	Price         float64  `json:"price" binding:"required"`
+	Renovation    int      `json:"renovation" binding:"required"`
+	Room          int      `json:"room" binding:"required"`
+	Size          float64  `json:"size" binding:"required"`
+	Special       int      `json:"special" binding:"required"`
+	SubjectMatter int      `json:"subjectmatter" binding:"required"`
+	Status        string   `json:"status"`   // 可选 draft 或 active, 默认 active
+	Latitude      *float64 `json:"latitude"` // 可选, 为空时根据地址定位
+	Longitude     *float64 `json:"longitude"`
 }
 
 func (req *CreatePropertyBaseInfoRequest) Validate() (bool, string) {
-	// 检查distinct必须是6位数
-	if req.Address.Distinct < 100000 || req.Address.Distinct > 999999 {
-		return false, "地区编码必须是6位数字"
+	// 检查distinct是存在的区县
+	if ok, msg := division.Validate(req.Address.Distinct); !ok {
+		return false, msg
 	}
 
 	// 检查details不为空
@@ -41,9 +54,8 @@ func (req *CreatePropertyBaseInfoRequest) Validate() (bool, string) {
 		return false, "地址详情不能为空"
 	}
 
-	// 检查Direction范围 (1-10)
-	if req.Direction < 1 || req.Direction > 10 {
-		return false, "朝向必须在1-10范围内"
+	if ok, msg := validEnum(enum.Direction, req.Direction); !ok {
+		return false, msg
 	}
 
 	if req.Height < 1 {
@@ -63,14 +75,12 @@ func (req *CreatePropertyBaseInfoRequest) Validate() (bool, string) {
 		return false, "价格必须大于0"
 	}
 
-	// 检查Renovation范围 (1-4)
-	if req.Renovation < 1 || req.Renovation > 4 {
-		return false, "装修状态必须在1-4范围内"
+	if ok, msg := validEnum(enum.Renovation, req.Renovation); !ok {
+		return false, msg
 	}
 
-	// 检查Room范围 (1-5)
-	if req.Room < 1 || req.Room > 11 {
-		return false, "房间类型必须在1-11范围内"
+	if ok, msg := validEnum(enum.Room, req.Room); !ok {
+		return false, msg
 	}
 
 	// 检查Size > 0
@@ -78,22 +88,81 @@ func (req *CreatePropertyBaseInfoRequest) Validate() (bool, string) {
 		return false, "面积必须大于0"
 	}
 
-	// 检查Special范围 (1-5)
-	if req.Special < 1 || req.Special > 5 {
-		return false, "特殊类型必须在1-5范围内"
+	if ok, msg := validEnum(enum.Special, req.Special); !ok {
+		return false, msg
 	}
 
-	// 检查SubjectMatter范围 (1-4)
-	if req.SubjectMatter < 1 || req.SubjectMatter > 4 {
-		return false, "标的物类型必须在1-4范围内"
+	if ok, msg := validEnum(enum.SubjectMatter, req.SubjectMatter); !ok {
+		return false, msg
+	}
+
+	// 新建房源只能是草稿或上架
+	if req.Status != "" && req.Status != consts.PropertyStatusDraft && req.Status != consts.PropertyStatusActive {
+		return false, "新建房源的状态只能是 draft 或 active"
+	}
+
+	if ok, msg := validateCoordinate(req.Latitude, req.Longitude); !ok {
+		return false, msg
 	}
 
 	return true, ""
 }
 
+// checkPropertyOwner 只有房源的创建者或拥有 property:manage_all 权限的用户可以修改、删除房源
+func checkPropertyOwner(c *gin.Context, property *models.Property) bool {
+	user, ok := currentUser(c)
+	if !ok {
+		return false
+	}
+
+	if rbac.HasPermission(user.Role, consts.PermPropertyManageAll) {
+		return true
+	}
+
+	if property.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"errno":   40320,
+			"message": "Forbidden, only the owner or manager can modify this property",
+		})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+type PropertyAgent struct {
+	Username string `json:"username"`
+	Phone    string `json:"phone"`
+}
+
+// getPropertyAgents 批量查询房源对应的经纪人, key 为 user id
+func getPropertyAgents(userIDs []uint) (map[uint]PropertyAgent, error) {
+	agents := make(map[uint]PropertyAgent)
+	if len(userIDs) == 0 {
+		return agents, nil
+	}
+
+	var users []models.User
+	// 经纪人离职后仍需显示其信息
+	if err := db.DB.Table(consts.UserTable).Unscoped().Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		agents[user.ID] = PropertyAgent{
+			Username: user.Username,
+			Phone:    user.Phone,
+		}
+	}
+
+	return agents, nil
+}
+
 func CreatePropertyBaseInfo(c *gin.Context) {
 
-	if ok := CheckUser(c); !ok {
+	user, ok := currentUser(c)
+	if !ok {
 		return
 	}
 
@@ -148,10 +217,16 @@ func CreatePropertyBaseInfo(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("Request: %+v\n", req)
-	fmt.Printf("New Property: %+v\n", newProperty)
-
 	newProperty.RichTextURL = ""
+	newProperty.UserID = user.ID
+	if newProperty.Status == "" {
+		newProperty.Status = consts.PropertyStatusActive
+	}
+	now := time.Now()
+	newProperty.StatusChangedAt = &now
+	if newProperty.Latitude == nil {
+		locateProperty(newProperty)
+	}
 
 	if err := db.DB.Table(consts.PropertyTable).Create(newProperty).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -162,6 +237,31 @@ func CreatePropertyBaseInfo(c *gin.Context) {
 		return
 	}
 
+	// 首次定价也作为一条价格记录
+	initialPrice := models.PropertyPriceHistory{
+		PropertyID: newProperty.ID,
+		Price:      newProperty.Price,
+		UserID:     user.ID,
+	}
+	if err := db.DB.Table(consts.PropertyPriceHistoryTable).Create(&initialPrice).Error; err != nil {
+		log.Println("failed to save initial price history: ", err)
+	}
+
+	initialStatus := models.PropertyStatusTransition{
+		PropertyID: newProperty.ID,
+		ToStatus:   newProperty.Status,
+		Reason:     "create",
+		UserID:     user.ID,
+	}
+	if err := db.DB.Table(consts.PropertyStatusTable).Create(&initialStatus).Error; err != nil {
+		log.Println("failed to save initial status transition: ", err)
+	}
+
+	audit.Record(c, audit.ActionCreate, audit.EntityProperty, newProperty.ID, nil, newProperty)
+
+	indexPropertyForSearch(newProperty, nil)
+	go notifySavedSearchMatches(nil, newProperty, user.ID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20020,
 		"message": "property created successfully",
@@ -196,6 +296,10 @@ func CreatePropertyImage(c *gin.Context) {
 		return
 	}
 
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
 	// 验证房源是否已经上传过图片
 	var propertyImage models.PropertyImage
 	result := db.DB.Table(consts.PropertyImageTable).Where("property_id = ?", propertyID).Limit(1).Find(&propertyImage)
@@ -251,6 +355,8 @@ func CreatePropertyImage(c *gin.Context) {
 			return
 		}
 
+		audit.Record(c, audit.ActionCreate, audit.EntityPropertyImage, property.ID, nil, []models.PropertyImage{defaultImage})
+
 		c.JSON(http.StatusOK, gin.H{
 			"errno":   20030,
 			"message": "successfully added default image",
@@ -263,7 +369,15 @@ func CreatePropertyImage(c *gin.Context) {
 
 	for i, file := range files {
 
-		url, err := OSS.UploadImageToOSS(c, file)
+		urls, err := OSS.UploadImageToOSS(c, file)
+		if errors.Is(err, OSS.ErrInvalidFile) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40033,
+				"message": "invalid image " + file.Filename + ": " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"errno":   50036,
@@ -275,9 +389,12 @@ func CreatePropertyImage(c *gin.Context) {
 
 		propertyIDUint, _ := strconv.ParseUint(propertyID, 10, 32)
 		image := models.PropertyImage{
-			PropertyID: uint(propertyIDUint),
-			URL:        url,
-			IsMain:     i == 0,
+			PropertyID:   uint(propertyIDUint),
+			URL:          urls.URL,
+			MediumURL:    urls.MediumURL,
+			ThumbnailURL: urls.ThumbnailURL,
+			SortOrder:    i,
+			IsMain:       i == 0,
 		}
 
 		if err := db.DB.Table(consts.PropertyImageTable).Create(&image).Error; err != nil {
@@ -292,6 +409,8 @@ func CreatePropertyImage(c *gin.Context) {
 		uploadedImages = append(uploadedImages, image)
 	}
 
+	audit.Record(c, audit.ActionCreate, audit.EntityPropertyImage, property.ID, nil, uploadedImages)
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "图片上传成功",
@@ -326,6 +445,10 @@ func CreatePropertyRichText(c *gin.Context) {
 		return
 	}
 
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
 	// 验证房源是否已经上传过富文本
 	if property.RichTextURL != "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -346,6 +469,8 @@ func CreatePropertyRichText(c *gin.Context) {
 		return
 	}
 
+	before := property
+
 	files := form.File["richText"]
 	if len(files) == 0 {
 		url := consts.DefaultHTMLUrl
@@ -359,6 +484,10 @@ func CreatePropertyRichText(c *gin.Context) {
 			return
 		}
 
+		audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID, before, property)
+		empty := ""
+		indexPropertyForSearch(&property, &empty)
+
 		c.JSON(http.StatusOK, gin.H{
 			"errno":   20000,
 			"message": "successfully created property by default richText",
@@ -385,6 +514,14 @@ func CreatePropertyRichText(c *gin.Context) {
 	}
 
 	url, err := OSS.UploadHTMLToOSS(c, richText)
+	if errors.Is(err, OSS.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40045,
+			"message": "invalid html file: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50040,
@@ -404,31 +541,53 @@ func CreatePropertyRichText(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID, before, property)
+	indexPropertyForSearch(&property, richTextContent(richText))
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "successfully created property rich text URL",
 	})
 }
 
+// PropertyImageItem 图片各尺寸的地址, 前端按场景选用, 默认图片的 ID 为 0
+type PropertyImageItem struct {
+	ID        uint   `json:"id"`
+	URL       string `json:"url"`
+	Medium    string `json:"medium"`
+	Thumbnail string `json:"thumbnail"`
+	IsMain    bool   `json:"isMain"`
+	Caption   string `json:"caption"`
+	RoomLabel string `json:"roomLabel"`
+}
+
 type GetPropertyByIDResponse struct {
 	Basic struct {
 		Address struct {
-			Distinct int    `json:"distinct"`
-			Details  string `json:"details"`
+			Distinct int            `json:"distinct"`
+			Details  string         `json:"details"`
+			Region   division.Names `json:"region"`
 		} `json:"address"`
-		Price         float64 `json:"price"`
-		Size          float64 `json:"size"`
-		Special       int     `json:"special"`
-		Height        int     `json:"height"`
-		TotalHeight   int     `json:"totalHeight"`
-		Subjectmatter int     `json:"subjectmatter"`
-		Renovation    int     `json:"renovation"`
-		Room          int     `json:"room"`
-		Direction     int     `json:"direction"`
-		UploadTime    string  `json:"uploadTime"`
+		Price         float64  `json:"price"`
+		Size          float64  `json:"size"`
+		Special       int      `json:"special"`
+		Height        int      `json:"height"`
+		TotalHeight   int      `json:"totalHeight"`
+		Subjectmatter int      `json:"subjectmatter"`
+		Renovation    int      `json:"renovation"`
+		Room          int      `json:"room"`
+		Direction     int      `json:"direction"`
+		UploadTime    string   `json:"uploadTime"`
+		Status        string   `json:"status"`
+		SoldPrice     *float64 `json:"soldPrice"`
 	} `json:"basic"`
-	Images   []string `json:"images"`
-	RichText string   `json:"richText"`
+	Labels        map[string]string    `json:"labels,omitempty"`
+	Agent         PropertyAgent        `json:"agent"`
+	Images        []string             `json:"images"`
+	ImageVariants []PropertyImageItem  `json:"imageVariants"`
+	RichText      string               `json:"richText"`
+	PriceHistory  []PriceHistoryItem   `json:"priceHistory"`
+	StatusHistory []PropertyStatusItem `json:"statusHistory"`
 }
 
 func GetPropertyByID(c *gin.Context) {
@@ -458,7 +617,7 @@ func GetPropertyByID(c *gin.Context) {
 	}
 
 	var propertyImages []models.PropertyImage
-	if err := db.DB.Table(consts.PropertyImageTable).Where("property_id=?", propertyID).Find(&propertyImages).Error; err != nil {
+	if err := db.DB.Table(consts.PropertyImageTable).Where("property_id=?", propertyID).Order("sort_order, id").Find(&propertyImages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50050,
 			"message": "failed to query property images: " + err.Error(),
@@ -476,8 +635,18 @@ func GetPropertyByID(c *gin.Context) {
 	}
 
 	var imageUrls []string
+	var imageVariants []PropertyImageItem
 	for _, image := range propertyImages {
 		imageUrls = append(imageUrls, image.URL)
+		imageVariants = append(imageVariants, PropertyImageItem{
+			ID:        image.ID,
+			URL:       image.URL,
+			Medium:    image.Medium(),
+			Thumbnail: image.Thumbnail(),
+			IsMain:    image.IsMain,
+			Caption:   image.Caption,
+			RoomLabel: image.RoomLabel,
+		})
 	}
 
 	var richText string
@@ -487,9 +656,40 @@ func GetPropertyByID(c *gin.Context) {
 		richText = consts.DefaultHTMLUrl
 	}
 
+	agents, err := getPropertyAgents([]uint{property.UserID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50051,
+			"message": "failed to query property agent: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	priceHistory, err := getPriceHistory(property.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50052,
+			"message": "failed to query price history: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	statusHistory, err := getStatusHistory(property.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50053,
+			"message": "failed to query status history: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
 	var response GetPropertyByIDResponse
 	response.Basic.Address.Distinct = property.Address.Distinct
 	response.Basic.Address.Details = property.Address.Details
+	response.Basic.Address.Region = division.Resolve(property.Address.Distinct)
 	response.Basic.Price = property.Price
 	response.Basic.Size = property.Size
 	response.Basic.Special = property.Special
@@ -500,8 +700,15 @@ func GetPropertyByID(c *gin.Context) {
 	response.Basic.Room = property.Room
 	response.Basic.Direction = property.Direction
 	response.Basic.UploadTime = property.CreatedAt.Format("2006-01-02 15:04:05")
+	response.Basic.Status = property.Status
+	response.Basic.SoldPrice = property.SoldPrice
+	response.Labels = propertyLabels(&property, labelLang(c))
+	response.Agent = agents[property.UserID]
 	response.Images = imageUrls
+	response.ImageVariants = imageVariants
 	response.RichText = richText
+	response.PriceHistory = priceHistory
+	response.StatusHistory = statusHistory
 
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
@@ -511,60 +718,148 @@ func GetPropertyByID(c *gin.Context) {
 
 }
 
+// propertySortKeys 房源列表允许的排序字段
+var propertySortKeys = map[string]string{
+	"created_at": "created_at",
+	"price":      "price",
+	"size":       "size",
+	"height":     "height",
+	"unit_price": unitPriceExpr,
+}
+
 type ListPropertyResponse struct {
-	Cover      string  `json:"cover"`
-	Address    string  `json:"address"`
-	Price      float64 `json:"price"`
-	Size       float64 `json:"size"`
-	HouseID    uint    `json:"houseID"`
-	UploadTime string  `json:"uploadTime"`
+	Cover      string            `json:"cover"`
+	Address    string            `json:"address"`
+	Region     division.Names    `json:"region"`
+	Price      float64           `json:"price"`
+	Size       float64           `json:"size"`
+	HouseID    uint              `json:"houseID"`
+	UploadTime string            `json:"uploadTime"`
+	Agent      PropertyAgent     `json:"agent"`
+	Status     string            `json:"status"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// getPropertyCovers 一次查询所有房源的主图, key 为 property id
+func getPropertyCovers(propertyIDs []uint) (map[uint]string, error) {
+	covers := make(map[uint]string)
+	if len(propertyIDs) == 0 {
+		return covers, nil
+	}
+
+	var images []models.PropertyImage
+	if err := db.DB.Table(consts.PropertyImageTable).Where("property_id IN ? AND is_main = ?", propertyIDs, true).Order("id").Find(&images).Error; err != nil {
+		return nil, err
+	}
+
+	// 与之前 Limit(1) 的行为一致, 每个房源取第一张主图
+	for _, image := range images {
+		if _, ok := covers[image.PropertyID]; !ok {
+			covers[image.PropertyID] = image.Thumbnail()
+		}
+	}
+
+	return covers, nil
 }
 
 func getListResponseByProperties(c *gin.Context, properties []models.Property) ([]ListPropertyResponse, bool) {
-	var response []ListPropertyResponse
+	userIDs := make([]uint, 0, len(properties))
+	propertyIDs := make([]uint, 0, len(properties))
 	for _, property := range properties {
+		userIDs = append(userIDs, property.UserID)
+		propertyIDs = append(propertyIDs, property.ID)
+	}
 
-		propertyImage := models.NewPropertyImage()
-		if err := db.DB.Table(consts.PropertyImageTable).Where("property_id=? AND is_main=?", property.ID, true).Limit(1).Find(propertyImage).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"errno":   50061,
-				"message": "failed to query property images: " + err.Error(),
-			})
-			c.Abort()
-			return nil, false
-		}
+	agents, err := getPropertyAgents(userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50062,
+			"message": "failed to query property agents: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
 
-		var cover string
-		if propertyImage.URL != "" {
-			cover = propertyImage.URL
-		} else {
-			cover = consts.DefaultImageUrl
-		}
+	covers, err := getPropertyCovers(propertyIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50061,
+			"message": "failed to query property images: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
 
-		if cover == "" {
+	lang := labelLang(c)
+
+	var response []ListPropertyResponse
+	for _, property := range properties {
+
+		cover, ok := covers[property.ID]
+		if !ok || cover == "" {
 			cover = consts.DefaultImageUrl
 		}
 
 		response = append(response, ListPropertyResponse{
 			Cover:      cover,
 			Address:    property.Address.Details,
+			Region:     division.Resolve(property.Address.Distinct),
 			Price:      property.Price,
 			Size:       property.Size,
 			HouseID:    property.ID,
 			UploadTime: property.CreatedAt.Format("2006-01-02 15:04:05"),
+			Agent:      agents[property.UserID],
+			Status:     property.Status,
+			Labels:     propertyLabels(&property, lang),
 		})
 	}
 
 	return response, true
 }
 
+// queryStatuses 读取 status=sold,withdrawn 参数查看其他状态, 默认只返回在售房源
+func queryStatuses(c *gin.Context) ([]string, error) {
+	value := c.Query("status")
+	if value == "" {
+		return []string{consts.PropertyStatusActive}, nil
+	}
+	statuses := strings.Split(value, ",")
+	for _, status := range statuses {
+		if !validPropertyStatus(status) {
+			return nil, fmt.Errorf("invalid status: %s", status)
+		}
+	}
+	return statuses, nil
+}
+
 func ListProperty(c *gin.Context) {
 	if ok := CheckUser(c); !ok {
 		return
 	}
 
+	p, err := page.Parse(c, propertySortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40061,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	statuses, err := queryStatuses(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40063,
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
 	var properties []models.Property
-	if err := db.DB.Table(consts.PropertyTable).Find(&properties).Error; err != nil {
+	total, err := p.Find(db.DB.Table(consts.PropertyTable).Where("status IN ?", statuses), &properties)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50060,
 			"message": "failed to query properties: " + err.Error(),
@@ -580,9 +875,11 @@ func ListProperty(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "successfully get all properties",
-		"results": response,
+		"errno":           20000,
+		"message":         "successfully get all properties",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
 	})
 }
 
@@ -592,14 +889,21 @@ type SelectPropertiesRequest struct {
 		City     int `json:"city"`
 		Distinct int `json:"distinct"`
 	} `json:"address"`
-	Price         []int `json:"price"`
-	Size          []int `json:"size"`
-	Special       []int `json:"special"`
-	Room          []int `json:"room"`
-	Direction     []int `json:"direction"`
-	Height        []int `json:"height"` // 1 [1,6], 2 [7, 15], 3 > 15
-	Renovation    []int `json:"renovation"`
-	SubjectMatter []int `json:"subjectmatter"`
+	Price         []int    `json:"price"`
+	Size          []int    `json:"size"`
+	Special       []int    `json:"special"`
+	Room          []int    `json:"room"`
+	Direction     []int    `json:"direction"`
+	Height        []int    `json:"height"` // 默认 1 [1,6], 2 [7, 15], 3 > 15, 管理员可以修改区间
+	Renovation    []int    `json:"renovation"`
+	SubjectMatter []int    `json:"subjectmatter"`
+	Status        []string `json:"status"`
+
+	// 自定义区间, 两端都包含
+	PriceRange     *NumberRange `json:"price_range"`      // 万
+	SizeRange      *NumberRange `json:"size_range"`       // ㎡
+	HeightRange    *NumberRange `json:"height_range"`     // 楼层
+	UnitPriceRange *NumberRange `json:"unit_price_range"` // 万/㎡
 }
 
 func (req *SelectPropertiesRequest) Validate() (bool, string) {
@@ -615,131 +919,85 @@ func (req *SelectPropertiesRequest) Validate() (bool, string) {
 	}
 
 	// 价格筛选
-	for _, price := range req.Price {
-		if price < 0 || price > 5 {
-			return false, "价格筛选值必须在0-5范围内"
-		}
+	if !validBucketIndexes(bucketFieldPrice, req.Price) {
+		return false, fmt.Sprintf("价格筛选值必须在0-%d范围内", len(getBuckets(bucketFieldPrice)))
 	}
 
 	// 面积筛选
-	for _, size := range req.Size {
-		if size < 0 || size > 5 {
-			return false, "面积筛选值必须在0-5范围内"
-		}
+	if !validBucketIndexes(bucketFieldSize, req.Size) {
+		return false, fmt.Sprintf("面积筛选值必须在0-%d范围内", len(getBuckets(bucketFieldSize)))
 	}
 
-	for _, special := range req.Special {
-		if special < 0 || special > 5 {
-			return false, "特殊类型筛选值必须在0-5范围内"
-		}
+	if ok, msg := validEnumFilter(enum.Special, req.Special); !ok {
+		return false, msg
 	}
 
-	for _, room := range req.Room {
-		if room < 0 || room > 11 {
-			return false, "房间数筛选值必须在0-11范围内"
-		}
+	if ok, msg := validEnumFilter(enum.Room, req.Room); !ok {
+		return false, msg
 	}
 
-	for _, direction := range req.Direction {
-		if direction < 0 || direction > 10 {
-			return false, "朝向筛选值必须在0-10范围内"
-		}
+	if ok, msg := validEnumFilter(enum.Direction, req.Direction); !ok {
+		return false, msg
 	}
 
-	for _, height := range req.Height {
-		if height < 0 || height > 3 {
-			return false, "楼层高度筛选值必须在0-3范围内"
-		}
+	if !validBucketIndexes(bucketFieldHeight, req.Height) {
+		return false, fmt.Sprintf("楼层高度筛选值必须在0-%d范围内", len(getBuckets(bucketFieldHeight)))
 	}
 
-	for _, renovation := range req.Renovation {
-		if renovation < 0 || renovation > 4 {
-			return false, "装修状态筛选值必须在0-4范围内"
+	for _, r := range []struct {
+		name  string
+		value *NumberRange
+	}{
+		{"价格区间", req.PriceRange},
+		{"面积区间", req.SizeRange},
+		{"楼层区间", req.HeightRange},
+		{"单价区间", req.UnitPriceRange},
+	} {
+		if ok, msg := r.value.Validate(r.name); !ok {
+			return false, msg
 		}
 	}
 
-	for _, subjectMatter := range req.SubjectMatter {
-		if subjectMatter < 0 || subjectMatter > 4 {
-			return false, "标的物类型筛选值必须在0-4范围内"
-		}
+	if ok, msg := validEnumFilter(enum.Renovation, req.Renovation); !ok {
+		return false, msg
 	}
 
-	return true, ""
-}
+	if ok, msg := validEnumFilter(enum.SubjectMatter, req.SubjectMatter); !ok {
+		return false, msg
+	}
 
-func SelectProperties(c *gin.Context) {
-	var req SelectPropertiesRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"errno":   40070,
-			"message": "failed to bind SelectProperties Request: " + err.Error(),
-		})
-		return
+	for _, status := range req.Status {
+		if !validPropertyStatus(status) {
+			return false, "状态筛选值必须是 draft, active, reserved, sold, withdrawn 之一"
+		}
 	}
 
-	query := db.DB.Table(consts.PropertyTable)
+	return true, ""
+}
 
-	// 地址筛选
+// applyPropertyFilters 把 SelectPropertiesRequest 中的筛选条件加到 query 上
+func applyPropertyFilters(query *gorm.DB, req *SelectPropertiesRequest) *gorm.DB {
+	// 地址筛选, 省市按编码区间查询以便使用索引
 	if req.Address.Province != 0 {
 		if req.Address.City == 1 {
-			query = query.Where("CAST(\"distinct\" AS TEXT) LIKE ?", fmt.Sprintf("%02d%%", req.Address.Province/10000))
+			province := req.Address.Province / 10000 * 10000
+			query = query.Where("\"distinct\" >= ? AND \"distinct\" < ?", province, province+10000)
 		} else if req.Address.Distinct == 0 {
-			query = query.Where("CAST(\"distinct\" AS TEXT) LIKE ?", fmt.Sprintf("%04d%%", req.Address.City/100))
+			city := req.Address.City / 100 * 100
+			query = query.Where("\"distinct\" >= ? AND \"distinct\" < ?", city, city+100)
 		} else {
 			query = query.Where("\"distinct\" = ?", req.Address.Distinct)
 		}
 	}
 
-	var priceValue = [][]float64{
-		{0, 0},
-		{0, 100},
-		{100, 300},
-		{300, 500},
-		{500, 1000},
-		{1000, math.MaxFloat64},
-	}
-	// 价格筛选
-	if len(req.Price) > 0 {
-		priceConditions := make([]string, 0)
-		for i := 0; i < len(req.Price); i++ {
-			priceConditions = append(priceConditions, fmt.Sprintf("(price >= %f AND price < %f)", priceValue[req.Price[i]][0], priceValue[req.Price[i]][1]))
-		}
-		query = query.Where(strings.Join(priceConditions, " OR "))
-	}
-
-	var sizeValue = [][]float64{
-		{0, 0},
-		{0, 50},
-		{50, 100},
-		{100, 150},
-		{150, 200},
-		{200, math.MaxFloat64},
-	}
-
-	// 面积筛选
-	if len(req.Size) > 0 {
-		sizeConditions := make([]string, 0)
-		for i := 0; i < len(req.Size); i++ {
-			sizeConditions = append(sizeConditions, fmt.Sprintf("(size >= %f AND size < %f)", sizeValue[req.Size[i]][0], sizeValue[req.Size[i]][1]))
-		}
-		query = query.Where(strings.Join(sizeConditions, " OR "))
-	}
-
-	var heightValue = [][]int{
-		{0, 0},
-		{1, 7},
-		{7, 16},
-		{16, math.MaxInt},
-	}
-
-	// 楼层筛选
-	if len(req.Height) > 0 {
-		heightConditions := make([]string, 0)
-		for i := 0; i < len(req.Height); i++ {
-			heightConditions = append(heightConditions, fmt.Sprintf("(height >= %d AND height < %d)", heightValue[req.Height[i]][0], heightValue[req.Height[i]][1]))
-		}
-		query = query.Where(strings.Join(heightConditions, " OR "))
-	}
+	// 价格、面积、楼层区间筛选, 自定义区间与预设区间同时生效
+	query = applyBucketFilter(query, "price", bucketFieldPrice, req.Price)
+	query = applyBucketFilter(query, "size", bucketFieldSize, req.Size)
+	query = applyBucketFilter(query, "height", bucketFieldHeight, req.Height)
+	query = applyRangeFilter(query, "price", req.PriceRange)
+	query = applyRangeFilter(query, "size", req.SizeRange)
+	query = applyRangeFilter(query, "height", req.HeightRange)
+	query = applyRangeFilter(query, unitPriceExpr, req.UnitPriceRange)
 
 	// 其他条件筛选
 	if len(req.Special) > 0 {
@@ -757,9 +1015,111 @@ func SelectProperties(c *gin.Context) {
 	if len(req.SubjectMatter) > 0 {
 		query = query.Where("subjectmatter IN ?", req.SubjectMatter)
 	}
+	// 未指定状态时只返回在售房源
+	if len(req.Status) > 0 {
+		query = query.Where("status IN ?", req.Status)
+	} else {
+		query = query.Where("status = ?", consts.PropertyStatusActive)
+	}
+
+	return query
+}
+
+// matchPropertyFilters 在内存中判断房源是否满足筛选条件, 与 applyPropertyFilters 保持一致
+func matchPropertyFilters(req *SelectPropertiesRequest, property *models.Property) bool {
+	distinct := property.Address.Distinct
+	if req.Address.Province != 0 {
+		if req.Address.City == 1 {
+			if distinct/10000 != req.Address.Province/10000 {
+				return false
+			}
+		} else if req.Address.Distinct == 0 {
+			if distinct/100 != req.Address.City/100 {
+				return false
+			}
+		} else if distinct != req.Address.Distinct {
+			return false
+		}
+	}
+
+	if len(req.Price) > 0 && !inBuckets(property.Price, bucketFieldPrice, req.Price) {
+		return false
+	}
+	if len(req.Size) > 0 && !inBuckets(property.Size, bucketFieldSize, req.Size) {
+		return false
+	}
+	if len(req.Height) > 0 && !inBuckets(float64(property.Height), bucketFieldHeight, req.Height) {
+		return false
+	}
+	if !req.PriceRange.contains(property.Price) || !req.SizeRange.contains(property.Size) || !req.HeightRange.contains(float64(property.Height)) {
+		return false
+	}
+	// 面积为 0 时 SQL 中单价为 NULL, 不满足任何单价区间
+	if req.UnitPriceRange != nil && (property.Size == 0 || !req.UnitPriceRange.contains(property.Price/property.Size)) {
+		return false
+	}
+
+	for _, f := range []struct {
+		values []int
+		value  int
+	}{
+		{req.Special, property.Special},
+		{req.Room, property.Room},
+		{req.Direction, property.Direction},
+		{req.Renovation, property.Renovation},
+		{req.SubjectMatter, property.SubjectMatter},
+	} {
+		if len(f.values) > 0 && !intIn(f.value, f.values) {
+			return false
+		}
+	}
+
+	if len(req.Status) == 0 {
+		return property.Status == consts.PropertyStatusActive
+	}
+	for _, status := range req.Status {
+		if property.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+func SelectProperties(c *gin.Context) {
+	var req SelectPropertiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40070,
+			"message": "failed to bind SelectProperties Request: " + err.Error(),
+		})
+		return
+	}
+
+	isValid, errMsg := req.Validate()
+	if !isValid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40072,
+			"message": "invalid SelectProperties Request: " + errMsg,
+		})
+		c.Abort()
+		return
+	}
+
+	p, err := page.Parse(c, propertySortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40071,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	query := applyPropertyFilters(db.DB.Table(consts.PropertyTable), &req)
 
 	var properties []models.Property
-	if err := query.Find(&properties).Error; err != nil {
+	total, err := p.Find(query, &properties)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50060,
 			"message": "failed to query properties: " + err.Error(),
@@ -773,20 +1133,78 @@ func SelectProperties(c *gin.Context) {
 		return
 	}
 
+	facets := make(map[string][]BucketFacet, 3)
+	for _, field := range []string{bucketFieldPrice, bucketFieldSize, bucketFieldHeight} {
+		facet, err := bucketFacets(&req, field)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50061,
+				"message": "failed to count facets: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		facets[field] = facet
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "successfully get selected properties",
-		"results": response,
+		"errno":           20000,
+		"message":         "successfully get selected properties",
+		"results":         response,
+		"facets":          facets,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
 	})
 }
 
+// indexPropertyForSearch 更新房源的搜索索引, content 为 nil 时保留原来的富文本内容, 失败只记录日志
+func indexPropertyForSearch(property *models.Property, content *string) {
+	doc := search.Document{
+		PropertyID: property.ID,
+		Address:    property.Address.Details,
+		District:   search.DistrictName(property.Address.Distinct),
+		Content:    content,
+	}
+	if err := search.Index(&doc); err != nil {
+		log.Println("failed to index property for search: ", err)
+	}
+}
+
+// richTextContent 提取上传的富文本中的文字用于搜索, 失败时返回 nil
+func richTextContent(file *multipart.FileHeader) *string {
+	f, err := file.Open()
+	if err != nil {
+		log.Println("failed to open rich text: ", err)
+		return nil
+	}
+	defer f.Close()
+
+	text, err := search.HTMLText(f)
+	if err != nil {
+		log.Println("failed to extract rich text: ", err)
+		return nil
+	}
+	return &text
+}
+
+type SearchPropertyResponse struct {
+	ListPropertyResponse
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight"`
+	Snippet   string  `json:"snippet"`
+}
+
+// SearchPropertyByAddr 搜索地址、行政区划名称和富文本, 支持拼音和首字母, 按相关度排序
 func SearchPropertyByAddr(c *gin.Context) {
 	if ok := CheckUser(c); !ok {
 		return
 	}
 
-	address := c.Query("address")
-	if address == "" {
+	searchTerm := strings.TrimSpace(c.Query("address"))
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		searchTerm = q
+	}
+	if searchTerm == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"errno":   40060,
 			"message": "address cannot be empty",
@@ -795,12 +1213,48 @@ func SearchPropertyByAddr(c *gin.Context) {
 		return
 	}
 
-	searchTerm := strings.TrimSpace(address)
+	p, err := page.Parse(c, map[string]string{"relevance": "score"}, "relevance")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40062,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
 
-	fmt.Println(searchTerm)
+	statuses, err := queryStatuses(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40064,
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
 
-	var properties []models.Property
-	if err := db.DB.Table(consts.PropertyTable).Where("details ILIKE ?", "%"+searchTerm+"%").Find(&properties).Error; err != nil {
+	hits, total, err := search.Search(searchTerm, search.Options{
+		Statuses: statuses,
+		Offset:   p.Offset(),
+		Limit:    p.PageSize,
+		Asc:      !p.Desc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50060,
+			"message": "failed to search properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.PropertyID)
+	}
+
+	var found []models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id IN ?", ids).Find(&found).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50060,
 			"message": "failed to query properties: " + err.Error(),
@@ -808,17 +1262,42 @@ func SearchPropertyByAddr(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	propertyMap := make(map[uint]models.Property, len(found))
+	for _, property := range found {
+		propertyMap[property.ID] = property
+	}
 
-	var response []ListPropertyResponse
-	response, ok := getListResponseByProperties(c, properties)
+	// 保持搜索结果的顺序
+	properties := make([]models.Property, 0, len(hits))
+	matchedHits := make([]search.Hit, 0, len(hits))
+	for _, hit := range hits {
+		if property, ok := propertyMap[hit.PropertyID]; ok {
+			properties = append(properties, property)
+			matchedHits = append(matchedHits, hit)
+		}
+	}
+
+	list, ok := getListResponseByProperties(c, properties)
 	if !ok {
 		return
 	}
 
+	response := make([]SearchPropertyResponse, 0, len(list))
+	for i, item := range list {
+		response = append(response, SearchPropertyResponse{
+			ListPropertyResponse: item,
+			Score:                matchedHits[i].Score,
+			Highlight:            matchedHits[i].Highlight,
+			Snippet:              matchedHits[i].Snippet,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "successfully get properties by address",
-		"results": response,
+		"errno":           20000,
+		"message":         "successfully get properties by address",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
 	})
 }
 
@@ -836,14 +1315,16 @@ type ModifyPropertyBaseInfoRequest struct {
 	Size          *float64 `json:"size"`
 	Special       *int     `json:"special"`
 	SubjectMatter *int     `json:"subjectmatter"`
+	Latitude      *float64 `json:"latitude"` // 修改地址但不传坐标时重新定位
+	Longitude     *float64 `json:"longitude"`
 }
 
 func (req *ModifyPropertyBaseInfoRequest) Validate() (bool, string) {
 	// 验证地址
 	if req.Address != nil {
 		if req.Address.Distinct != nil {
-			if *req.Address.Distinct < 100000 || *req.Address.Distinct > 999999 {
-				return false, "地区编码必须是6位数字"
+			if ok, msg := division.Validate(*req.Address.Distinct); !ok {
+				return false, msg
 			}
 		}
 
@@ -856,8 +1337,8 @@ func (req *ModifyPropertyBaseInfoRequest) Validate() (bool, string) {
 
 	// 验证其他字段
 	if req.Direction != nil {
-		if *req.Direction < 1 || *req.Direction > 10 {
-			return false, "朝向必须在1-10范围内"
+		if ok, msg := validEnum(enum.Direction, *req.Direction); !ok {
+			return false, msg
 		}
 	}
 
@@ -886,14 +1367,14 @@ func (req *ModifyPropertyBaseInfoRequest) Validate() (bool, string) {
 	}
 
 	if req.Renovation != nil {
-		if *req.Renovation < 1 || *req.Renovation > 4 {
-			return false, "装修状态必须在1-4范围内"
+		if ok, msg := validEnum(enum.Renovation, *req.Renovation); !ok {
+			return false, msg
 		}
 	}
 
 	if req.Room != nil {
-		if *req.Room < 1 || *req.Room > 11 {
-			return false, "房间类型必须在1-11范围内"
+		if ok, msg := validEnum(enum.Room, *req.Room); !ok {
+			return false, msg
 		}
 	}
 
@@ -904,17 +1385,21 @@ func (req *ModifyPropertyBaseInfoRequest) Validate() (bool, string) {
 	}
 
 	if req.Special != nil {
-		if *req.Special < 1 || *req.Special > 5 {
-			return false, "特殊类型必须在1-5范围内"
+		if ok, msg := validEnum(enum.Special, *req.Special); !ok {
+			return false, msg
 		}
 	}
 
 	if req.SubjectMatter != nil {
-		if *req.SubjectMatter < 1 || *req.SubjectMatter > 4 {
-			return false, "标的物类型必须在1-4范围内"
+		if ok, msg := validEnum(enum.SubjectMatter, *req.SubjectMatter); !ok {
+			return false, msg
 		}
 	}
 
+	if ok, msg := validateCoordinate(req.Latitude, req.Longitude); !ok {
+		return false, msg
+	}
+
 	return true, ""
 }
 
@@ -946,6 +1431,10 @@ func ModifyPropertyBaseInfo(c *gin.Context) {
 		return
 	}
 
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
 	// 解析请求体
 	var req ModifyPropertyBaseInfoRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -968,24 +1457,35 @@ func ModifyPropertyBaseInfo(c *gin.Context) {
 		return
 	}
 
-	// 检查重名
-	var existingProperty models.Property
-	result := db.DB.Table(consts.PropertyTable).Where("\"distinct\" = ? AND details = ?", req.Address.Distinct, req.Address.Details).Limit(1).Find(&existingProperty)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"errno":   50080,
-			"message": "failed to query database: " + result.Error.Error(),
-		})
-		c.Abort()
-		return
-	}
-	if result.RowsAffected > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"errno":   40082,
-			"message": "address already exists",
-		})
-		c.Abort()
-		return
+	// 修改地址时检查重名
+	if req.Address != nil {
+		distinct := property.Address.Distinct
+		if req.Address.Distinct != nil {
+			distinct = *req.Address.Distinct
+		}
+		details := property.Address.Details
+		if req.Address.Details != nil {
+			details = *req.Address.Details
+		}
+
+		var existingProperty models.Property
+		result := db.DB.Table(consts.PropertyTable).Where("\"distinct\" = ? AND details = ? AND id <> ?", distinct, details, property.ID).Limit(1).Find(&existingProperty)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50080,
+				"message": "failed to query database: " + result.Error.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if result.RowsAffected > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40082,
+				"message": "address already exists",
+			})
+			c.Abort()
+			return
+		}
 	}
 
 	// 只更新非空字段
@@ -1029,10 +1529,35 @@ func ModifyPropertyBaseInfo(c *gin.Context) {
 	if req.SubjectMatter != nil {
 		updates["subjectmatter"] = *req.SubjectMatter
 	}
+	if req.Latitude != nil {
+		updates["latitude"] = *req.Latitude
+		updates["longitude"] = *req.Longitude
+	} else if req.Address != nil {
+		located := property
+		if req.Address.Distinct != nil {
+			located.Address.Distinct = *req.Address.Distinct
+		}
+		if req.Address.Details != nil {
+			located.Address.Details = *req.Address.Details
+		}
+		located.Latitude, located.Longitude = nil, nil
+		locateProperty(&located)
+		// 定位失败时清空旧坐标, 避免显示在原来的位置
+		updates["latitude"] = located.Latitude
+		updates["longitude"] = located.Longitude
+	}
 
 	// 更新房产信息
 	if len(updates) > 0 {
-		if err := db.DB.Table(consts.PropertyTable).Where("id=?", propertyID).Updates(updates).Error; err != nil {
+		user, ok := currentUser(c)
+		if !ok {
+			return
+		}
+
+		tx := db.DB.Begin()
+
+		if err := tx.Table(consts.PropertyTable).Where("id=?", propertyID).Updates(updates).Error; err != nil {
+			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"errno":   50081,
 				"message": "failed to update property: " + err.Error(),
@@ -1040,6 +1565,43 @@ func ModifyPropertyBaseInfo(c *gin.Context) {
 			c.Abort()
 			return
 		}
+
+		// 价格变化时记录历史
+		if req.Price != nil && *req.Price != property.Price {
+			history := models.PropertyPriceHistory{
+				PropertyID: property.ID,
+				OldPrice:   property.Price,
+				Price:      *req.Price,
+				UserID:     user.ID,
+			}
+			if err := tx.Table(consts.PropertyPriceHistoryTable).Create(&history).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"errno":   50412,
+					"message": "failed to save price history: " + err.Error(),
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50413,
+				"message": "failed to update property: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		updated := models.NewProperty()
+		if err := db.DB.Table(consts.PropertyTable).Where("id=?", propertyID).First(updated).Error; err == nil {
+			audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID, property, updated)
+			if req.Address != nil {
+				indexPropertyForSearch(updated, nil)
+			}
+			go notifySavedSearchMatches(&property, updated, user.ID)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1077,6 +1639,10 @@ func ModifyPropertyImage(c *gin.Context) {
 		return
 	}
 
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
 	// 获取上传的文件
 	form, err := c.MultipartForm()
 	if err != nil {
@@ -1090,9 +1656,71 @@ func ModifyPropertyImage(c *gin.Context) {
 
 	files := form.File["images"]
 
-	// 开始事务
+	// 先处理并上传所有图片, 上传期间不占用事务
+	propertyIDUint, _ := strconv.ParseUint(propertyID, 10, 32)
+	newImages := make([]models.PropertyImage, 0, len(files))
+	for i, file := range files {
+		urls, err := OSS.UploadImageToOSS(c, file)
+		if errors.Is(err, OSS.ErrInvalidFile) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40093,
+				"message": "invalid image " + file.Filename + ": " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50092,
+				"message": "OSS upload image error: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		newImages = append(newImages, models.PropertyImage{
+			PropertyID:   uint(propertyIDUint),
+			URL:          urls.URL,
+			MediumURL:    urls.MediumURL,
+			ThumbnailURL: urls.ThumbnailURL,
+			SortOrder:    i,
+			IsMain:       i == 0, // 第一张为主图
+		})
+	}
+
+	// 如果没有上传任何图片，使用默认图片
+	if len(files) == 0 {
+		newImages = append(newImages, models.PropertyImage{
+			PropertyID: uint(propertyIDUint),
+			URL:        consts.DefaultImageUrl,
+			IsMain:     true, // 设为主图
+		})
+	}
+
+	// 开始事务, 锁住房源避免与设置主图、排序等操作同时修改图集
 	tx := db.DB.Begin()
 
+	if err := lockPropertyImages(tx, property.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50096,
+			"message": "failed to lock property: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var oldImages []models.PropertyImage
+	if err := tx.Table(consts.PropertyImageTable).Where("property_id=? AND deleted_at IS NULL", propertyID).Find(&oldImages).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50094,
+			"message": "failed to query old images: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
 	// 先删除原有图片
 	if err := tx.Table(consts.PropertyImageTable).Where("property_id=?", propertyID).Delete(&models.PropertyImage{}).Error; err != nil {
 		tx.Rollback()
@@ -1104,75 +1732,40 @@ func ModifyPropertyImage(c *gin.Context) {
 		return
 	}
 
-	// 如果没有上传任何图片，使用默认图片
-	if len(files) == 0 {
-		// 添加默认图片
-		propertyIDUint, _ := strconv.ParseUint(propertyID, 10, 32)
-		defaultImage := models.PropertyImage{
-			PropertyID: uint(propertyIDUint),
-			URL:        consts.DefaultImageUrl,
-			IsMain:     true, // 设为主图
-		}
+	if err := tx.Table(consts.PropertyImageTable).Create(&newImages).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50093,
+			"message": "save new image error: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
 
-		if err := tx.Table(consts.PropertyImageTable).Create(&defaultImage).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"errno":   50091,
-				"message": "save default image error: " + err.Error(),
-			})
-			c.Abort()
-			return
-		}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50095,
+			"message": "failed to save images: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionUpdate, audit.EntityPropertyImage, property.ID, oldImages, newImages)
 
-		tx.Commit()
+	if len(files) == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"errno":   20090,
 			"message": "successfully reset to default image",
-			"image":   defaultImage,
+			"image":   newImages[0],
 		})
 		return
 	}
 
-	var uploadedImages []models.PropertyImage
-
-	for i, file := range files {
-		url, err := OSS.UploadImageToOSS(c, file)
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"errno":   50092,
-				"message": "OSS upload image error: " + err.Error(),
-			})
-			c.Abort()
-			return
-		}
-
-		propertyIDUint, _ := strconv.ParseUint(propertyID, 10, 32)
-		image := models.PropertyImage{
-			PropertyID: uint(propertyIDUint),
-			URL:        url,
-			IsMain:     i == 0, // 第一张为主图
-		}
-
-		if err := tx.Table(consts.PropertyImageTable).Create(&image).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"errno":   50093,
-				"message": "save new image error: " + err.Error(),
-			})
-			c.Abort()
-			return
-		}
-
-		uploadedImages = append(uploadedImages, image)
-	}
-
-	tx.Commit()
-
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20091,
 		"message": "successfully modified property images",
-		"images":  uploadedImages,
+		"images":  newImages,
 	})
 }
 
@@ -1204,6 +1797,10 @@ func ModifyPropertyRichText(c *gin.Context) {
 		return
 	}
 
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
 	form, err := c.MultipartForm()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -1214,6 +1811,8 @@ func ModifyPropertyRichText(c *gin.Context) {
 		return
 	}
 
+	before := property
+
 	files := form.File["richText"]
 
 	// 如果没有上传文件，设置为默认富文本
@@ -1228,6 +1827,10 @@ func ModifyPropertyRichText(c *gin.Context) {
 			return
 		}
 
+		audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID, before, property)
+		empty := ""
+		indexPropertyForSearch(&property, &empty)
+
 		c.JSON(http.StatusOK, gin.H{
 			"errno":       20100,
 			"message":     "successfully reset to default rich text",
@@ -1257,6 +1860,14 @@ func ModifyPropertyRichText(c *gin.Context) {
 	}
 
 	url, err := OSS.UploadHTMLToOSS(c, richText)
+	if errors.Is(err, OSS.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40105,
+			"message": "invalid html file: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50101,
@@ -1276,6 +1887,9 @@ func ModifyPropertyRichText(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID, before, property)
+	indexPropertyForSearch(&property, richTextContent(richText))
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":       20101,
 		"message":     "successfully updated property rich text",
@@ -1298,6 +1912,20 @@ func DeleteProperty(c *gin.Context) {
 		return
 	}
 
+	var property models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id=?", propertyID).First(&property).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40111,
+			"message": "property does not exist: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
 	if err := db.DB.Table(consts.PropertyTable).Where("id=?", propertyID).Delete(&models.Property{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50110,
@@ -1316,6 +1944,12 @@ func DeleteProperty(c *gin.Context) {
 		return
 	}
 
+	if err := search.Remove(property.ID); err != nil {
+		log.Println("failed to remove property from search index: ", err)
+	}
+
+	audit.Record(c, audit.ActionDelete, audit.EntityProperty, property.ID, property, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20110,
 		"message": "property deleted successfully",
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"gorm.io/gorm"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// coversOneByOne 批量查询之前的写法, 每个房源单独查询第一张主图
+func coversOneByOne(propertyIDs []uint) (map[uint]string, error) {
+	covers := make(map[uint]string)
+	for _, id := range propertyIDs {
+		var images []models.PropertyImage
+		if err := db.DB.Table(consts.PropertyImageTable).Where("property_id = ? AND is_main = ?", id, true).Order("id").Limit(1).Find(&images).Error; err != nil {
+			return nil, err
+		}
+		if len(images) > 0 {
+			covers[id] = images[0].Thumbnail()
+		}
+	}
+	return covers, nil
+}
+
+func TestGetPropertyCovers(t *testing.T) {
+	queries := useTestDB(t)
+
+	twoMains := createTestProperty(t, "two mains")
+	noThumbnail := createTestProperty(t, "no thumbnail")
+	noMain := createTestProperty(t, "no main")
+	noImages := createTestProperty(t, "no images")
+	deletedMain := createTestProperty(t, "deleted main")
+
+	createTestImages(t, []models.PropertyImage{
+		{PropertyID: twoMains, URL: "a-extra.jpg", ThumbnailURL: "a-extra-thumb.jpg"},
+		{PropertyID: twoMains, URL: "a-main.jpg", ThumbnailURL: "a-main-thumb.jpg", IsMain: true},
+		{PropertyID: twoMains, URL: "a-main-2.jpg", ThumbnailURL: "a-main-2-thumb.jpg", IsMain: true},
+		{PropertyID: noThumbnail, URL: "b-main.jpg", IsMain: true},
+		{PropertyID: noMain, URL: "c-extra.jpg", ThumbnailURL: "c-extra-thumb.jpg"},
+		{
+			Model:        gorm.Model{DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}},
+			PropertyID:   deletedMain,
+			URL:          "e-deleted.jpg",
+			ThumbnailURL: "e-deleted-thumb.jpg",
+			IsMain:       true,
+		},
+		{PropertyID: deletedMain, URL: "e-main.jpg", ThumbnailURL: "e-main-thumb.jpg", IsMain: true},
+	})
+
+	// 每个房源取 id 最小的未删除主图, 没有缩略图时用原图, 没有主图的房源不返回
+	want := map[uint]string{
+		twoMains:    "a-main-thumb.jpg",
+		noThumbnail: "b-main.jpg",
+		deletedMain: "e-main-thumb.jpg",
+	}
+	ids := []uint{twoMains, noThumbnail, noMain, noImages, deletedMain}
+
+	for name, fetch := range map[string]func([]uint) (map[uint]string, error){
+		"batched":    getPropertyCovers,
+		"one by one": coversOneByOne,
+	} {
+		covers, err := fetch(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(covers) != len(want) {
+			t.Errorf("%s: got %d covers %v, want %v", name, len(covers), covers, want)
+		}
+		for id, cover := range want {
+			if covers[id] != cover {
+				t.Errorf("%s: cover of property %d = %q, want %q", name, id, covers[id], cover)
+			}
+		}
+	}
+
+	for _, batch := range [][]uint{nil, {twoMains}, ids} {
+		atomic.StoreInt64(queries, 0)
+		if _, err := getPropertyCovers(batch); err != nil {
+			t.Fatal(err)
+		}
+		want := int64(1)
+		if len(batch) == 0 {
+			want = 0
+		}
+		if got := atomic.LoadInt64(queries); got != want {
+			t.Errorf("getPropertyCovers(%d ids) ran %d queries, want %d", len(batch), got, want)
+		}
+	}
+}
+
+func benchmarkCovers(b *testing.B, fetch func([]uint) (map[uint]string, error)) {
+	queries := useTestDB(b)
+
+	// 列表默认每页 20 个房源, 每个房源三张图片, 第二张为主图
+	ids := make([]uint, 0, 20)
+	for i := 0; i < 20; i++ {
+		id := createTestProperty(b, fmt.Sprintf("bench %d", i))
+		ids = append(ids, id)
+		createTestImages(b, []models.PropertyImage{
+			{PropertyID: id, URL: "extra.jpg"},
+			{PropertyID: id, URL: "main.jpg", ThumbnailURL: "main-thumb.jpg", IsMain: true},
+			{PropertyID: id, URL: "extra-2.jpg"},
+		})
+	}
+
+	atomic.StoreInt64(queries, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fetch(ids); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(queries))/float64(b.N), "queries/op")
+}
+
+func BenchmarkPropertyCoversOneByOne(b *testing.B) {
+	benchmarkCovers(b, coversOneByOne)
+}
+
+func BenchmarkPropertyCoversBatched(b *testing.B) {
+	benchmarkCovers(b, getPropertyCovers)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/utils/division"
+	"net/http"
+	"strconv"
+)
+
+// ListRegions 返回下一级行政区划, code 为空时返回所有省级行政区, tree=true 时返回整棵树
+func ListRegions(c *gin.Context) {
+	if c.Query("tree") == "true" {
+		c.JSON(http.StatusOK, gin.H{
+			"errno":   20000,
+			"message": "get region tree successfully",
+			"results": division.Tree(),
+		})
+		return
+	}
+
+	code := 0
+	if codeStr := c.Query("code"); codeStr != "" {
+		var err error
+		code, err = strconv.Atoi(codeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"errno":   40220,
+				"message": "invalid region code: " + codeStr,
+			})
+			c.Abort()
+			return
+		}
+	}
+
+	children, ok := division.Children(code)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40221,
+			"message": "region not found",
+		})
+		c.Abort()
+		return
+	}
+
+	// 只返回下一级, 不展开更深的层级
+	results := make([]gin.H, 0, len(children))
+	for _, child := range children {
+		results = append(results, gin.H{
+			"code":         child.Code,
+			"name":         child.Name,
+			"has_children": len(child.Children) > 0,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "get regions successfully",
+		"results": results,
+	})
+}
+
+// GetRegion 返回编码对应的各级名称
+func GetRegion(c *gin.Context) {
+	code, err := strconv.Atoi(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40220,
+			"message": "invalid region code: " + c.Param("code"),
+		})
+		c.Abort()
+		return
+	}
+
+	if _, ok := division.Lookup(code); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40221,
+			"message": "region not found",
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "get region successfully",
+		"code":    code,
+		"result":  division.Resolve(code),
+	})
+}
@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/notify"
+	"github.com/hewo233/house-system-backend/utils/page"
+	"log"
+	"net/http"
+)
+
+// 每个用户最多保存的筛选条件数量
+const maxSavedSearches = 20
+
+var savedSearchSortKeys = map[string]string{
+	"created_at": "created_at",
+	"name":       "name",
+}
+
+type SavedSearchRequest struct {
+	Name   string                  `json:"name" binding:"required"`
+	Filter SelectPropertiesRequest `json:"filter"`
+	Notify *bool                   `json:"notify"`
+}
+
+func (req *SavedSearchRequest) Validate() (bool, string) {
+	if len(req.Name) == 0 || len(req.Name) > 50 {
+		return false, "名称长度必须在1-50之间"
+	}
+	return req.Filter.Validate()
+}
+
+type SavedSearchResponse struct {
+	ID     uint                    `json:"id"`
+	Name   string                  `json:"name"`
+	Filter SelectPropertiesRequest `json:"filter"`
+	Notify bool                    `json:"notify"`
+}
+
+func toSavedSearchResponse(search *models.SavedSearch) SavedSearchResponse {
+	response := SavedSearchResponse{
+		ID:     search.ID,
+		Name:   search.Name,
+		Notify: search.Notify,
+	}
+	if err := json.Unmarshal([]byte(search.Filter), &response.Filter); err != nil {
+		log.Println("failed to unmarshal saved search filter: ", err)
+	}
+	return response
+}
+
+// loadSavedSearch 只能访问自己的筛选条件
+func loadSavedSearch(c *gin.Context, user *models.User) (*models.SavedSearch, bool) {
+	search := models.NewSavedSearch()
+	result := db.DB.Table(consts.SavedSearchTable).Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Limit(1).Find(search)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50180,
+			"message": "failed to query database: " + result.Error.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40180,
+			"message": "saved search not found",
+		})
+		c.Abort()
+		return nil, false
+	}
+	return search, true
+}
+
+func CreateSavedSearch(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40181,
+			"message": "failed to bind SavedSearch Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40182,
+			"message": "invalid SavedSearch Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	var count int64
+	if err := db.DB.Table(consts.SavedSearchTable).Where("user_id = ? AND deleted_at IS NULL", user.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50181,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if count >= maxSavedSearches {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40183,
+			"message": fmt.Sprintf("at most %d saved searches per user", maxSavedSearches),
+		})
+		c.Abort()
+		return
+	}
+
+	filter, err := json.Marshal(req.Filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50182,
+			"message": "failed to marshal filter: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	search := models.SavedSearch{
+		UserID: user.ID,
+		Name:   req.Name,
+		Filter: string(filter),
+		Notify: req.Notify == nil || *req.Notify,
+	}
+	if err := db.DB.Table(consts.SavedSearchTable).Create(&search).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50183,
+			"message": "failed to create saved search: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "create saved search successfully",
+		"result":  toSavedSearchResponse(&search),
+	})
+}
+
+func ListSavedSearches(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	p, err := page.Parse(c, savedSearchSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40184,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var searches []models.SavedSearch
+	total, err := p.Find(db.DB.Table(consts.SavedSearchTable).Where("user_id = ?", user.ID), &searches)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50184,
+			"message": "failed to query database: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	response := make([]SavedSearchResponse, 0, len(searches))
+	for i := range searches {
+		response = append(response, toSavedSearchResponse(&searches[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "list saved searches successfully",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
+
+func ModifySavedSearch(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	search, ok := loadSavedSearch(c, user)
+	if !ok {
+		return
+	}
+
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40181,
+			"message": "failed to bind SavedSearch Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40182,
+			"message": "invalid SavedSearch Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	filter, err := json.Marshal(req.Filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50182,
+			"message": "failed to marshal filter: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	search.Name = req.Name
+	search.Filter = string(filter)
+	if req.Notify != nil {
+		search.Notify = *req.Notify
+	}
+	if err := db.DB.Table(consts.SavedSearchTable).Save(search).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50185,
+			"message": "failed to update saved search: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "update saved search successfully",
+		"result":  toSavedSearchResponse(search),
+	})
+}
+
+func DeleteSavedSearch(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	search, ok := loadSavedSearch(c, user)
+	if !ok {
+		return
+	}
+
+	if err := db.DB.Table(consts.SavedSearchTable).Delete(search).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50186,
+			"message": "failed to delete saved search: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "delete saved search successfully",
+	})
+}
+
+// RunSavedSearch 按保存的条件查询房源, 结果与 /house/select 一致
+func RunSavedSearch(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	search, ok := loadSavedSearch(c, user)
+	if !ok {
+		return
+	}
+
+	p, err := page.Parse(c, propertySortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40184,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var req SelectPropertiesRequest
+	if err := json.Unmarshal([]byte(search.Filter), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50187,
+			"message": "failed to unmarshal filter: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var properties []models.Property
+	total, err := p.Find(applyPropertyFilters(db.DB.Table(consts.PropertyTable), &req), &properties)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50188,
+			"message": "failed to query properties: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	response, ok := getListResponseByProperties(c, properties)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":           20000,
+		"message":         "successfully run saved search",
+		"results":         response,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
+	})
+}
+
+// notifySavedSearchMatches 给新匹配上的筛选条件的所有者发送通知, 不通知操作人自己
+// before 为修改前的房源, 新建时为 nil, 修改前已经匹配的筛选条件不再重复通知
+func notifySavedSearchMatches(before *models.Property, property *models.Property, actorID uint) {
+	var searches []models.SavedSearch
+	if err := db.DB.Table(consts.SavedSearchTable).Where("notify = ? AND deleted_at IS NULL", true).Find(&searches).Error; err != nil {
+		log.Println("failed to query saved searches: ", err)
+		return
+	}
+
+	// 只有一套房源, 直接在内存中判断每个筛选条件
+	for _, search := range searches {
+		if search.UserID == actorID {
+			continue
+		}
+
+		var req SelectPropertiesRequest
+		if err := json.Unmarshal([]byte(search.Filter), &req); err != nil {
+			log.Println("failed to unmarshal saved search filter: ", err)
+			continue
+		}
+		if !matchPropertyFilters(&req, property) || (before != nil && matchPropertyFilters(&req, before)) {
+			continue
+		}
+
+		notification := models.Notification{
+			UserID:        search.UserID,
+			Type:          notify.TypeSavedSearchMatch,
+			Title:         fmt.Sprintf("「%s」有新的匹配房源", search.Name),
+			Content:       fmt.Sprintf("%s, %.2f万, %.2f㎡", property.Address.Details, property.Price, property.Size),
+			PropertyID:    property.ID,
+			SavedSearchID: search.ID,
+		}
+		if err := notify.Send(&notification); err != nil {
+			log.Println("failed to send notification: ", err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"net/http"
+	"time"
+)
+
+// propertyStatusTransitions 允许的状态变更, sold 为最终状态
+var propertyStatusTransitions = map[string][]string{
+	consts.PropertyStatusDraft:     {consts.PropertyStatusActive, consts.PropertyStatusWithdrawn},
+	consts.PropertyStatusActive:    {consts.PropertyStatusReserved, consts.PropertyStatusSold, consts.PropertyStatusWithdrawn},
+	consts.PropertyStatusReserved:  {consts.PropertyStatusActive, consts.PropertyStatusSold, consts.PropertyStatusWithdrawn},
+	consts.PropertyStatusWithdrawn: {consts.PropertyStatusActive},
+	consts.PropertyStatusSold:      {},
+}
+
+func validPropertyStatus(status string) bool {
+	_, ok := propertyStatusTransitions[status]
+	return ok
+}
+
+func canTransitPropertyStatus(from string, to string) bool {
+	for _, next := range propertyStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type PropertyStatusItem struct {
+	FromStatus string        `json:"fromStatus"`
+	ToStatus   string        `json:"toStatus"`
+	Reason     string        `json:"reason"`
+	ChangedAt  string        `json:"changedAt"`
+	ChangedBy  PropertyAgent `json:"changedBy"`
+}
+
+func getStatusHistory(propertyID uint) ([]PropertyStatusItem, error) {
+	var transitions []models.PropertyStatusTransition
+	if err := db.DB.Table(consts.PropertyStatusTable).Where("property_id = ?", propertyID).Order("created_at, id").Find(&transitions).Error; err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]uint, 0, len(transitions))
+	for _, transition := range transitions {
+		userIDs = append(userIDs, transition.UserID)
+	}
+	agents, err := getPropertyAgents(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]PropertyStatusItem, 0, len(transitions))
+	for _, transition := range transitions {
+		items = append(items, PropertyStatusItem{
+			FromStatus: transition.FromStatus,
+			ToStatus:   transition.ToStatus,
+			Reason:     transition.Reason,
+			ChangedAt:  transition.CreatedAt.Format("2006-01-02 15:04:05"),
+			ChangedBy:  agents[transition.UserID],
+		})
+	}
+
+	return items, nil
+}
+
+type ModifyPropertyStatusRequest struct {
+	Status           string   `json:"status" binding:"required"`
+	Reason           string   `json:"reason" binding:"required"`
+	TransactionPrice *float64 `json:"transaction_price"` // 状态为 sold 时必填
+}
+
+func (req *ModifyPropertyStatusRequest) Validate() (bool, string) {
+	if !validPropertyStatus(req.Status) {
+		return false, "状态必须是 draft, active, reserved, sold, withdrawn 之一"
+	}
+	if len(req.Reason) == 0 || len(req.Reason) > 255 {
+		return false, "原因不能为空且不能超过255个字符"
+	}
+	if req.Status == consts.PropertyStatusSold {
+		if req.TransactionPrice == nil || *req.TransactionPrice <= 0 {
+			return false, "成交时必须填写大于0的成交价"
+		}
+	} else if req.TransactionPrice != nil {
+		return false, "只有成交时可以填写成交价"
+	}
+	return true, ""
+}
+
+func ModifyPropertyStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	propertyID := c.Param("houseID")
+
+	var property models.Property
+	if err := db.DB.Table(consts.PropertyTable).Where("id=?", propertyID).First(&property).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40160,
+			"message": "property does not exist: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok := checkPropertyOwner(c, &property); !ok {
+		return
+	}
+
+	var req ModifyPropertyStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40161,
+			"message": "failed to bind ModifyPropertyStatus Request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40162,
+			"message": "invalid ModifyPropertyStatus Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	if !canTransitPropertyStatus(property.Status, req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40163,
+			"message": "cannot change status from " + property.Status + " to " + req.Status,
+		})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":            req.Status,
+		"status_changed_at": now,
+	}
+	if req.Status == consts.PropertyStatusSold {
+		updates["sold_price"] = *req.TransactionPrice
+	}
+
+	tx := db.DB.Begin()
+
+	// 以旧状态为条件, 防止并发修改
+	result := tx.Table(consts.PropertyTable).Where("id = ? AND status = ?", property.ID, property.Status).Updates(updates)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50160,
+			"message": "failed to update property status: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{
+			"errno":   40960,
+			"message": "property status has been changed by others, please retry",
+		})
+		c.Abort()
+		return
+	}
+
+	transition := models.PropertyStatusTransition{
+		PropertyID: property.ID,
+		FromStatus: property.Status,
+		ToStatus:   req.Status,
+		Reason:     req.Reason,
+		UserID:     user.ID,
+	}
+	if err := tx.Table(consts.PropertyStatusTable).Create(&transition).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50161,
+			"message": "failed to save status transition: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50162,
+			"message": "failed to update property status: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID,
+		gin.H{"status": property.Status, "sold_price": property.SoldPrice},
+		gin.H{"status": req.Status, "sold_price": req.TransactionPrice, "reason": req.Reason},
+	)
+
+	// 草稿发布、下架后重新上架时通知保存的筛选条件
+	before := property
+	property.Status = req.Status
+	property.StatusChangedAt = &now
+	if req.Status == consts.PropertyStatusSold {
+		property.SoldPrice = req.TransactionPrice
+	}
+	go notifySavedSearchMatches(&before, &property, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":   20000,
+		"message": "property status updated successfully",
+		"status":  req.Status,
+	})
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/OSS"
+	"github.com/hewo233/house-system-backend/utils/audit"
+	"github.com/hewo233/house-system-backend/utils/search"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type PresignUploadRequest struct {
+	Kind     string `json:"kind" binding:"required"` // image, richtext
+	Filename string `json:"filename"`
+}
+
+func (req *PresignUploadRequest) Validate() (bool, string) {
+	if req.Kind != consts.UploadKindImage && req.Kind != consts.UploadKindRichText {
+		return false, "kind 必须是 image 或 richtext"
+	}
+	if len(req.Filename) > 255 {
+		return false, "文件名不能超过255个字符"
+	}
+	return true, ""
+}
+
+// PresignUpload 返回直传对象存储的 POST 表单, 上传完成后调用 ConfirmUpload
+func PresignUpload(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	property, ok := loadImageProperty(c)
+	if !ok {
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40280,
+			"message": "failed to bind request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40281,
+			"message": "invalid PresignUpload Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	upload, err := OSS.PresignUpload(c, property.ID, user.ID, req.Kind, req.Filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50280,
+			"message": "failed to presign upload: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"errno":      20000,
+		"message":    "presign upload successfully",
+		"upload_url": upload.URL,
+		"form_data":  upload.FormData,
+		"object_key": upload.ObjectKey,
+		"method":     http.MethodPost,
+		"max_size":   consts.DirectUploadLimit,
+		"expires_at": time.Now().Add(consts.PresignExpire),
+	})
+}
+
+type ConfirmUploadRequest struct {
+	Kind      string `json:"kind" binding:"required"`
+	ObjectKey string `json:"object_key" binding:"required"`
+	// 以下只对图片有效
+	Caption   string `json:"caption"`
+	RoomLabel string `json:"room_label"`
+	IsMain    bool   `json:"is_main"`
+}
+
+func (req *ConfirmUploadRequest) Validate() (bool, string) {
+	if req.Kind != consts.UploadKindImage && req.Kind != consts.UploadKindRichText {
+		return false, "kind 必须是 image 或 richtext"
+	}
+	return validImageLabels(&req.Caption, &req.RoomLabel)
+}
+
+// ConfirmUpload 检查直传的文件, 图片重新编码后加入图集, 富文本清理后设为房源的富文本, 最后删除临时文件
+func ConfirmUpload(c *gin.Context) {
+	if ok := CheckUser(c); !ok {
+		return
+	}
+
+	property, ok := loadImageProperty(c)
+	if !ok {
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req ConfirmUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40282,
+			"message": "failed to bind request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if ok, msg := req.Validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40283,
+			"message": "invalid ConfirmUpload Request: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
+	// 只能确认自己为这个房源申请的上传
+	if !strings.HasPrefix(req.ObjectKey, OSS.StagedObjectPrefix(property.ID, user.ID)) || strings.Contains(req.ObjectKey, "..") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"errno":   40380,
+			"message": "object key does not belong to this upload",
+		})
+		c.Abort()
+		return
+	}
+
+	data, err := OSS.ReadStagedObject(c, req.ObjectKey, consts.DirectUploadLimit)
+	if errors.Is(err, OSS.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40284,
+			"message": "invalid upload: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50281,
+			"message": "failed to read upload: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	var result gin.H
+	if req.Kind == consts.UploadKindImage {
+		result, ok = confirmImageUpload(c, property, &req, data)
+	} else {
+		result, ok = confirmRichTextUpload(c, property, &req, data)
+	}
+	if !ok {
+		return
+	}
+
+	// 临时文件删除失败不影响结果, 由孤儿文件清理兜底
+	if err := OSS.RemoveObject(c, req.ObjectKey); err != nil {
+		log.Println("failed to remove staged upload: ", err)
+	}
+
+	result["errno"] = 20000
+	result["message"] = "confirm upload successfully"
+	c.JSON(http.StatusOK, result)
+}
+
+func confirmImageUpload(c *gin.Context, property *models.Property, req *ConfirmUploadRequest, data []byte) (gin.H, bool) {
+	urls, err := OSS.UploadImageBytesToOSS(c, req.ObjectKey, data)
+	if errors.Is(err, OSS.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40285,
+			"message": "invalid image: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50282,
+			"message": "failed to upload image: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	image := models.PropertyImage{
+		PropertyID:   property.ID,
+		URL:          urls.URL,
+		MediumURL:    urls.MediumURL,
+		ThumbnailURL: urls.ThumbnailURL,
+		Caption:      req.Caption,
+		RoomLabel:    req.RoomLabel,
+	}
+	if err := appendPropertyImage(property.ID, &image, req.IsMain); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50283,
+			"message": "failed to save image: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	audit.Record(c, audit.ActionCreate, audit.EntityPropertyImage, property.ID, nil, image)
+	return gin.H{"image": image}, true
+}
+
+func confirmRichTextUpload(c *gin.Context, property *models.Property, req *ConfirmUploadRequest, data []byte) (gin.H, bool) {
+	url, err := OSS.UploadHTMLBytesToOSS(c, req.ObjectKey, data)
+	if errors.Is(err, OSS.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40286,
+			"message": "invalid html file: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50284,
+			"message": "failed to upload html file: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	before := *property
+	if err := db.DB.Table(consts.PropertyTable).Where("id = ?", property.ID).Update("rich_text_url", url).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50285,
+			"message": "failed to update property rich text URL: " + err.Error(),
+		})
+		c.Abort()
+		return nil, false
+	}
+	property.RichTextURL = url
+
+	audit.Record(c, audit.ActionUpdate, audit.EntityProperty, property.ID, before, *property)
+
+	var content *string
+	if text, err := search.HTMLText(bytes.NewReader(data)); err != nil {
+		log.Println("failed to extract rich text: ", err)
+	} else {
+		content = &text
+	}
+	indexPropertyForSearch(property, content)
+
+	return gin.H{"url": url}, true
+}
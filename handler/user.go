@@ -6,7 +6,9 @@ import (
 	"github.com/hewo233/house-system-backend/models"
 	"github.com/hewo233/house-system-backend/shared/consts"
 	"github.com/hewo233/house-system-backend/utils/jwt"
+	"github.com/hewo233/house-system-backend/utils/page"
 	"github.com/hewo233/house-system-backend/utils/password"
+	"gorm.io/gorm"
 	"net/http"
 )
 
@@ -28,8 +30,8 @@ func UserRegister(c *gin.Context) {
 		return
 	}
 
-	correctInviteCodeModel := models.InviteCode{}
-	result := db.DB.Table(consts.InviteCodeTable).Where("id = ?", 1).First(&correctInviteCodeModel)
+	inviteCode := models.NewInviteCode()
+	result := db.DB.Table(consts.InviteCodeTable).Where("code = ?", req.InviteCode).Limit(1).Find(inviteCode)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50000,
@@ -39,7 +41,7 @@ func UserRegister(c *gin.Context) {
 		return
 	}
 
-	if req.InviteCode != correctInviteCodeModel.Code {
+	if result.RowsAffected == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"errno":   40001,
 			"message": "invalid invite code",
@@ -48,6 +50,15 @@ func UserRegister(c *gin.Context) {
 		return
 	}
 
+	if ok, msg := checkInviteCodeUsable(inviteCode); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40001,
+			"message": "invalid invite code: " + msg,
+		})
+		c.Abort()
+		return
+	}
+
 	if req.Username == "" || len(req.Password) < 6 || len(req.Phone) != 11 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"errno":   40002,
@@ -87,14 +98,46 @@ func UserRegister(c *gin.Context) {
 		return
 	}
 
+	role := inviteCode.Role
+	if role == "" {
+		role = consts.RoleAgent
+	}
+
 	newUser := models.User{
 		Username: req.Username,
 		Password: hashedPassword,
 		Phone:    req.Phone,
-		Role:     "user",
+		Role:     role,
+		Team:     inviteCode.Team,
+	}
+
+	tx := db.DB.Begin()
+
+	// 在条件中检查次数, 防止并发注册超过使用上限
+	result = tx.Table(consts.InviteCodeTable).
+		Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", inviteCode.ID).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50012,
+			"message": "failed to redeem invite code: " + result.Error.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40001,
+			"message": "invalid invite code: invite code has been used up",
+		})
+		c.Abort()
+		return
 	}
 
-	if err := db.DB.Table(consts.UserTable).Create(&newUser).Error; err != nil {
+	if err := tx.Table(consts.UserTable).Create(&newUser).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50002,
 			"message": "failed to create user: " + err.Error(),
@@ -103,6 +146,31 @@ func UserRegister(c *gin.Context) {
 		return
 	}
 
+	redemption := models.InviteRedemption{
+		InviteCodeID: inviteCode.ID,
+		Code:         inviteCode.Code,
+		UserID:       newUser.ID,
+		Phone:        newUser.Phone,
+	}
+	if err := tx.Table(consts.InviteRedemptionTable).Create(&redemption).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50012,
+			"message": "failed to redeem invite code: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"errno":   50008,
+			"message": "failed to create user: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "user created successfully",
@@ -119,7 +187,8 @@ type UserLoginResponse struct {
 		Phone    string `json:"phone"`
 		Username string `json:"username"`
 	} `json:"user"`
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 func UserLogin(c *gin.Context) {
@@ -170,7 +239,7 @@ func UserLogin(c *gin.Context) {
 		return
 	}
 
-	jwtToken, err := jwt.GenerateJWT(req.Phone, consts.User)
+	jwtToken, refreshToken, err := jwt.CreateSession(req.Phone, consts.User)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50004,
@@ -182,6 +251,7 @@ func UserLogin(c *gin.Context) {
 
 	var rep UserLoginResponse
 	rep.Token = jwtToken
+	rep.RefreshToken = refreshToken
 	rep.User.Username = user.Username
 	rep.User.Phone = user.Phone
 
@@ -193,6 +263,28 @@ func UserLogin(c *gin.Context) {
 
 }
 
+// currentUser 获取 jwt 中的用户, 失败时已写入响应
+func currentUser(c *gin.Context) (*models.User, bool) {
+	_, user, err := jwt.GetPhoneFromJWT(c)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"errno":   40100,
+				"message": "Unauthorized, user in jwt not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50005,
+				"message": "failed to get user info: " + err.Error(),
+			})
+		}
+		c.Abort()
+		return nil, false
+	}
+
+	return user, true
+}
+
 func CheckUser(c *gin.Context) bool {
 	// admin can access too
 	_, _, err := jwt.GetPhoneFromJWT(c)
@@ -267,17 +359,7 @@ func GetUserInfoByPhone(c *gin.Context) {
 }
 
 func ModifyUserSelf(c *gin.Context) {
-	phone, user, err := jwt.GetPhoneFromJWT(c)
-
-	if phone == "admin" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"errno":   40012,
-			"message": "admin is not user",
-		})
-		c.Abort()
-		return
-	}
-
+	_, user, err := jwt.GetPhoneFromJWT(c)
 	if err != nil {
 		if err.Error() == "user not found" {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -345,12 +427,29 @@ func ModifyUserSelf(c *gin.Context) {
 		return
 	}
 
+	// 修改密码后其他设备需要重新登录
+	if updateData.Password != "" {
+		if err := jwt.RevokeSubjectSessions(user.Phone, c.GetUint("session_id")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"errno":   50013,
+				"message": "failed to revoke sessions: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"errno":   20000,
 		"message": "user updated successfully",
 	})
 }
 
+var userSortKeys = map[string]string{
+	"created_at": "created_at",
+	"username":   "username",
+}
+
 type ListUserResponse struct {
 	Phone    string `json:"phone"`
 	Username string `json:"username"`
@@ -362,13 +461,23 @@ func ListUser(c *gin.Context) {
 		return
 	}
 
+	p, err := page.Parse(c, userSortKeys, "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"errno":   40009,
+			"message": "invalid page request: " + err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
 	var users []models.User
 
-	result := db.DB.Table(consts.UserTable).Find(&users)
-	if result.Error != nil {
+	total, err := p.Find(db.DB.Table(consts.UserTable), &users)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"errno":   50007,
-			"message": "failed to query database: " + result.Error.Error(),
+			"message": "failed to query database: " + err.Error(),
 		})
 		c.Abort()
 		return
@@ -384,8 +493,10 @@ func ListUser(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"errno":   20000,
-		"message": "get user list successfully",
-		"results": rep,
+		"errno":           20000,
+		"message":         "get user list successfully",
+		"results":         rep,
+		"total":           total,
+		"next_page_token": p.NextPageToken(total),
 	})
 }
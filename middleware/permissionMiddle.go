@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	myjwt "github.com/hewo233/house-system-backend/utils/jwt"
+	"github.com/hewo233/house-system-backend/utils/rbac"
+	"log"
+	"net/http"
+)
+
+// RequirePermission 必须在 JWTAuth 之后使用
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := myjwt.GetPhoneFromJWT(c)
+		if err != nil {
+			log.Println("Get user from jwt error: ", err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"errno":   40152,
+				"message": "Unauthorized, user in jwt not found",
+			})
+			c.Abort()
+			return
+		}
+
+		if !rbac.HasPermission(user.Role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"errno":   40350,
+				"message": "Forbidden, permission required: " + permission,
+			})
+			c.Abort()
+			return
+		}
+	}
+}
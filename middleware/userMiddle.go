@@ -47,7 +47,27 @@ func JWTAuth(audience string) gin.HandlerFunc {
 				return
 			}
 
+			active, err := myjwt.IsSessionActive(claims.SessionID)
+			if err != nil {
+				log.Println("Check session error: ", err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"errno":   50420,
+					"message": "failed to check session: " + err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"errno":   40420,
+					"message": "Unauthorized, session has been revoked or expired",
+				})
+				c.Abort()
+				return
+			}
+
 			c.Set("phone", claims.StandardClaims.Id)
+			c.Set("session_id", claims.SessionID)
 		}
 	}
 }
@@ -1,8 +1,31 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type InviteCode struct {
 	gorm.Model
-	Code string `json:"code" gorm:"uniqueIndex;size:6;not null"`
+	Code      string     `json:"code" gorm:"uniqueIndex;size:32;not null"`
+	ExpiresAt *time.Time `json:"expires_at"`                           // 为空表示永不过期
+	MaxUses   int        `json:"max_uses" gorm:"not null;default:0"`   // 0 表示不限次数
+	UsedCount int        `json:"used_count" gorm:"not null;default:0"` // 已使用次数
+	Role      string     `json:"role" gorm:"size:10;default:'agent'"`  // 注册后的角色
+	Team      string     `json:"team" gorm:"size:50"`                  // 注册后的团队
+	Revoked   bool       `json:"revoked" gorm:"default:false"`
+	CreatedBy string     `json:"created_by" gorm:"size:11"` // 创建邀请码的管理员
+}
+
+func NewInviteCode() *InviteCode {
+	return &InviteCode{}
+}
+
+// InviteRedemption 邀请码使用记录
+type InviteRedemption struct {
+	gorm.Model
+	InviteCodeID uint   `json:"invite_code_id" gorm:"index;not null"`
+	Code         string `json:"code" gorm:"size:32;not null"`
+	UserID       uint   `json:"user_id" gorm:"index;not null"`
+	Phone        string `json:"phone" gorm:"size:11;not null"`
 }
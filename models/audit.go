@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuditLog 审计日志只追加, 不更新也不删除, 所以不使用 gorm.Model
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ActorID    uint      `json:"actor_id" gorm:"index"`
+	ActorPhone string    `json:"actor_phone" gorm:"size:11;index"`
+	Action     string    `json:"action" gorm:"size:50;index;not null"`      // create, update, delete ...
+	EntityType string    `json:"entity_type" gorm:"size:50;index;not null"` // property, customer, user ...
+	EntityID   string    `json:"entity_id" gorm:"size:255;index"`
+	Before     string    `json:"before" gorm:"type:text"` // JSON
+	After      string    `json:"after" gorm:"type:text"`  // JSON
+	Diff       string    `json:"diff" gorm:"type:text"`   // JSON, 只包含变化的字段
+	IP         string    `json:"ip" gorm:"size:64"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
@@ -11,8 +11,25 @@ type Customer struct {
 	Gender     string `json:"gender" gorm:"size:5;not null"`
 	Price      string `json:"price" gorm:"size:255;not null"`
 	Other      string `json:"other" gorm:"size:255;not null"`
+	UserID     uint   `json:"user_id" gorm:"column:user_id;index"` // 录入客户的经纪人
 }
 
 func NewCustomer() *Customer {
 	return &Customer{}
 }
+
+// CustomerRequirement 客户的购房需求, 区间下标与房源筛选条件一致
+type CustomerRequirement struct {
+	gorm.Model
+	CustomerID uint  `json:"customer_id" gorm:"column:customer_id;uniqueIndex;not null"`  // customers 表的 id
+	Districts  []int `json:"districts" gorm:"column:districts;serializer:json;type:text"` // 省、市或区县编码
+	Price      []int `json:"price" gorm:"column:price;serializer:json;type:text"`
+	Size       []int `json:"size" gorm:"column:size;serializer:json;type:text"`
+	Room       []int `json:"room" gorm:"column:room;serializer:json;type:text"`
+	Renovation []int `json:"renovation" gorm:"column:renovation;serializer:json;type:text"`
+	Height     []int `json:"height" gorm:"column:height;serializer:json;type:text"`
+}
+
+func NewCustomerRequirement() *CustomerRequirement {
+	return &CustomerRequirement{}
+}
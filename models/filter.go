@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// FilterBucket 管理员配置的筛选区间, 左闭右开, Max 为空表示不设上限
+type FilterBucket struct {
+	gorm.Model
+	Field    string   `json:"field" gorm:"size:20;index;not null"` // price, size, height
+	Position int      `json:"position" gorm:"not null"`            // 从 1 开始, 即筛选请求中的下标
+	Min      float64  `json:"min" gorm:"not null"`
+	Max      *float64 `json:"max"`
+	Label    string   `json:"label" gorm:"size:50"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// CustomerFollowUp 客户跟进记录, 按时间倒序组成时间线
+type CustomerFollowUp struct {
+	gorm.Model
+	CustomerID   uint       `json:"customer_id" gorm:"column:customer_id;index;not null"` // customers 表的 id
+	UserID       uint       `json:"user_id" gorm:"column:user_id;index;not null"`         // 跟进的经纪人
+	Type         string     `json:"type" gorm:"size:20;not null"`                         // call, visit, note
+	Content      string     `json:"content" gorm:"type:text"`
+	NextAction   string     `json:"next_action" gorm:"size:255"`
+	NextActionAt *time.Time `json:"next_action_at" gorm:"index"`
+}
+
+// Appointment 带看预约, 同一经纪人的预约时间不能重叠
+type Appointment struct {
+	gorm.Model
+	CustomerID uint      `json:"customer_id" gorm:"column:customer_id;index;not null"` // customers 表的 id
+	PropertyID uint      `json:"property_id" gorm:"column:property_id;index;not null"`
+	AgentID    uint      `json:"agent_id" gorm:"column:agent_id;index;not null"`
+	StartAt    time.Time `json:"start_at" gorm:"index;not null"`
+	EndAt      time.Time `json:"end_at" gorm:"not null"`
+	Status     string    `json:"status" gorm:"size:20;index;default:'scheduled'"`
+	Note       string    `json:"note" gorm:"size:255"`
+	CreatedBy  uint      `json:"created_by"`
+}
+
+func NewAppointment() *Appointment {
+	return &Appointment{}
+}
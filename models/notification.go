@@ -0,0 +1,31 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// SavedSearch 用户保存的房源筛选条件
+type SavedSearch struct {
+	gorm.Model
+	UserID uint   `json:"user_id" gorm:"column:user_id;index;not null"`
+	Name   string `json:"name" gorm:"size:50;not null"`
+	Filter string `json:"filter" gorm:"type:text;not null"` // SelectPropertiesRequest 的 JSON
+	Notify bool   `json:"notify" gorm:"default:true"`       // 有新房源匹配时是否通知
+}
+
+func NewSavedSearch() *SavedSearch {
+	return &SavedSearch{}
+}
+
+// Notification 站内通知
+type Notification struct {
+	gorm.Model
+	UserID        uint       `json:"user_id" gorm:"column:user_id;index;not null"`
+	Type          string     `json:"type" gorm:"size:50;index;not null"`
+	Title         string     `json:"title" gorm:"size:255;not null"`
+	Content       string     `json:"content" gorm:"type:text"`
+	PropertyID    uint       `json:"property_id" gorm:"column:property_id"`
+	SavedSearchID uint       `json:"saved_search_id" gorm:"column:saved_search_id"`
+	ReadAt        *time.Time `json:"read_at" gorm:"index"`
+}
@@ -1,9 +1,12 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type Address struct {
-	Distinct int    `json:"distinct" gorm:"column:distinct;not null;type:integer"`
+	Distinct int    `json:"distinct" gorm:"column:distinct;not null;type:integer;index"`
 	Details  string `json:"details" gorm:"column:details;size:255"`
 }
 
@@ -20,6 +23,15 @@ type Property struct {
 	Special       int     `json:"special" gorm:"column:special"`                       // 5
 	SubjectMatter int     `json:"subjectmatter" gorm:"column:subjectmatter;not null"`  // 4
 	RichTextURL   string  `json:"rich_text_url" gorm:"column:rich_text_url;size:1024"` // 富文本内容
+	UserID        uint    `json:"user_id" gorm:"column:user_id;index"`                 // 创建房源的经纪人
+
+	Status          string     `json:"status" gorm:"column:status;size:20;not null;default:'active';index"` // draft, active, reserved, sold, withdrawn
+	StatusChangedAt *time.Time `json:"status_changed_at" gorm:"column:status_changed_at"`
+	SoldPrice       *float64   `json:"sold_price" gorm:"column:sold_price"` // 成交价
+
+	// 坐标系与前端地图一致, 未定位时为空
+	Latitude  *float64 `json:"latitude" gorm:"column:latitude;index:idx_properties_location"`
+	Longitude *float64 `json:"longitude" gorm:"column:longitude;index:idx_properties_location"`
 }
 
 func NewProperty() *Property {
@@ -28,11 +40,51 @@ func NewProperty() *Property {
 
 type PropertyImage struct {
 	gorm.Model
-	PropertyID uint   `json:"property_id" gorm:"column:property_id;index;not null"`
-	URL        string `json:"url" gorm:"column:url;not null;size:1024"`
-	IsMain     bool   `json:"is_main" gorm:"column:is_main;default:false"` // 是否为主图
+	PropertyID   uint   `json:"property_id" gorm:"column:property_id;index;not null"`
+	URL          string `json:"url" gorm:"column:url;not null;size:1024"`               // 重新编码后的大图
+	MediumURL    string `json:"medium_url" gorm:"column:medium_url;size:1024"`          // 最长边 1024
+	ThumbnailURL string `json:"thumbnail_url" gorm:"column:thumbnail_url;size:1024"`    // 最长边 320, 列表封面
+	IsMain       bool   `json:"is_main" gorm:"column:is_main;default:false"`            // 是否为主图
+	SortOrder    int    `json:"sort_order" gorm:"column:sort_order;not null;default:0"` // 图集中的顺序, 从小到大
+	Caption      string `json:"caption" gorm:"column:caption;size:200"`                 // 图片说明
+	RoomLabel    string `json:"room_label" gorm:"column:room_label;size:50"`            // 所属房间, 如 客厅、主卧
+}
+
+// Thumbnail 旧数据和默认图片没有缩略图时使用原图
+func (i *PropertyImage) Thumbnail() string {
+	if i.ThumbnailURL != "" {
+		return i.ThumbnailURL
+	}
+	return i.URL
+}
+
+// Medium 同上
+func (i *PropertyImage) Medium() string {
+	if i.MediumURL != "" {
+		return i.MediumURL
+	}
+	return i.URL
 }
 
 func NewPropertyImage() *PropertyImage {
 	return &PropertyImage{}
 }
+
+// PropertyPriceHistory 每次调价一条记录, 首次定价 OldPrice 为 0
+type PropertyPriceHistory struct {
+	gorm.Model
+	PropertyID uint    `json:"property_id" gorm:"column:property_id;index;not null"`
+	OldPrice   float64 `json:"old_price" gorm:"column:old_price;not null;default:0"`
+	Price      float64 `json:"price" gorm:"column:price;not null"`
+	UserID     uint    `json:"user_id" gorm:"column:user_id"` // 调价的经纪人
+}
+
+// PropertyStatusTransition 房源状态变更记录
+type PropertyStatusTransition struct {
+	gorm.Model
+	PropertyID uint   `json:"property_id" gorm:"column:property_id;index;not null"`
+	FromStatus string `json:"from_status" gorm:"column:from_status;size:20"`
+	ToStatus   string `json:"to_status" gorm:"column:to_status;size:20;not null"`
+	Reason     string `json:"reason" gorm:"column:reason;size:255"`
+	UserID     uint   `json:"user_id" gorm:"column:user_id"`
+}
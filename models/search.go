@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PropertySearchDoc 房源搜索索引, 每个房源一行, tsv 由 utils/search 写入
+type PropertySearchDoc struct {
+	PropertyID uint      `json:"property_id" gorm:"primaryKey;autoIncrement:false"`
+	Address    string    `json:"address" gorm:"size:255"`
+	District   string    `json:"district" gorm:"size:255"`
+	Content    string    `json:"content" gorm:"type:text"` // 富文本的纯文本
+	TSV        string    `json:"-" gorm:"column:tsv;type:tsvector;<-:false"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
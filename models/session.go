@@ -0,0 +1,27 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session 登录会话, 刷新令牌只保存哈希
+type Session struct {
+	gorm.Model
+	Subject          string     `json:"subject" gorm:"size:11;index;not null"` // 用户手机号
+	Audience         string     `json:"audience" gorm:"size:10;not null"`
+	RefreshTokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+}
+
+// UsedRefreshToken 已经轮换掉的 refresh token, 再次出现说明令牌被盗用
+type UsedRefreshToken struct {
+	gorm.Model
+	SessionID uint   `json:"session_id" gorm:"index;not null"`
+	TokenHash string `json:"-" gorm:"size:64;uniqueIndex;not null"`
+}
+
+func NewSession() *Session {
+	return &Session{}
+}
@@ -9,7 +9,8 @@ type User struct {
 	Username string `json:"username" gorm:"uniqueIndex;size:50;not null"`
 	Password string `json:"-" gorm:"size:100;not null"`
 	Phone    string `json:"phone" gorm:"size:11;not null"`
-	Role     string `json:"role" gorm:"size:10;default:'user'"` // admin, user
+	Role     string `json:"role" gorm:"size:10;default:'user'"` // admin, team_lead, agent, viewer, 旧数据为 user
+	Team     string `json:"team" gorm:"size:50"`
 }
 
 func NewUser() *User {
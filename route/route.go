@@ -19,54 +19,125 @@ func InitRoute() {
 
 	R.GET("/ping", handler.Ping)
 
+	region := R.Group("/region")
+	{
+		region.GET("/list", handler.ListRegions)
+		region.GET("/info/:code", handler.GetRegion)
+	}
+
+	meta := R.Group("/meta")
+	{
+		meta.GET("/enums", handler.ListEnums)
+	}
+
 	auth := R.Group("/auth")
 	{
 		auth.POST("/register", handler.UserRegister)
 		auth.POST("/login", handler.UserLogin)
 		auth.POST("/admin/login", handler.AdminLogin)
+		auth.POST("/refresh", handler.RefreshToken)
+		auth.POST("/logout", handler.Logout)
 	}
 
 	user := R.Group("/user")
-	user.Use(middleware.JWTAuth("user"))
+	user.Use(middleware.JWTAuth(consts.User))
 	{
-		user.GET("/info/:phone", handler.GetUserInfoByPhone)
+		user.GET("/info/:phone", middleware.RequirePermission(consts.PermUserView), handler.GetUserInfoByPhone)
 		user.POST("/update", handler.ModifyUserSelf)
-		user.GET("/list", handler.ListUser)
+		user.GET("/list", middleware.RequirePermission(consts.PermUserView), handler.ListUser)
+
+		user.GET("/notifications", handler.ListNotifications)
+		user.PUT("/notifications/read/:id", handler.ReadNotification)
+		user.PUT("/notifications/read_all", handler.ReadAllNotifications)
 	}
 
 	admin := R.Group("/admin")
 	admin.Use(middleware.JWTAuth(consts.Admin))
 	{
-		admin.GET("/info/:phone", handler.GetUserInfoByPhone)
-		admin.GET("/list", handler.ListUser)
-		admin.DELETE("/delete/user/:phone", handler.AdminRemoveUserByPhone)
-		admin.POST("/invite_code", handler.AdminModifyInviteCode)
-
-		admin.GET("/customer/list", handler.AdminListCustomers)
-		admin.PUT("/customer/update/:customer_id", handler.ModifyCustomers)
-		admin.DELETE("/customer/delete/:customer_id", handler.DeleteCustomers)
+		admin.GET("/info/:phone", middleware.RequirePermission(consts.PermUserView), handler.GetUserInfoByPhone)
+		admin.GET("/list", middleware.RequirePermission(consts.PermUserView), handler.ListUser)
+		admin.DELETE("/delete/user/:phone", middleware.RequirePermission(consts.PermUserManage), handler.AdminRemoveUserByPhone)
+		admin.PUT("/user/role/:phone", middleware.RequirePermission(consts.PermUserManage), handler.AdminAssignRole)
+		admin.GET("/roles", middleware.RequirePermission(consts.PermUserManage), handler.AdminListRoles)
+		admin.GET("/audit", middleware.RequirePermission(consts.PermAuditView), handler.AdminListAuditLogs)
+		admin.PUT("/buckets/:field", middleware.RequirePermission(consts.PermPropertyManageAll), handler.AdminSetBuckets)
+		admin.DELETE("/buckets/:field", middleware.RequirePermission(consts.PermPropertyManageAll), handler.AdminResetBuckets)
+		admin.POST("/oss/gc", middleware.RequirePermission(consts.PermPropertyManageAll), handler.AdminCollectOSSGarbage)
+
+		admin.POST("/invite_code", middleware.RequirePermission(consts.PermInviteManage), handler.AdminCreateInviteCode)
+		admin.GET("/invite_code/list", middleware.RequirePermission(consts.PermInviteManage), handler.AdminListInviteCodes)
+		admin.GET("/invite_code/redemptions", middleware.RequirePermission(consts.PermInviteManage), handler.AdminListInviteRedemptions)
+		admin.DELETE("/invite_code/:code", middleware.RequirePermission(consts.PermInviteManage), handler.AdminRevokeInviteCode)
+
+		admin.GET("/customer/list", middleware.RequirePermission(consts.PermCustomerManage), handler.AdminListCustomers)
+		admin.PUT("/customer/update/:customer_id", middleware.RequirePermission(consts.PermCustomerManage), handler.ModifyCustomers)
+		admin.DELETE("/customer/delete/:customer_id", middleware.RequirePermission(consts.PermCustomerManage), handler.DeleteCustomers)
+		admin.PUT("/customer/reassign", middleware.RequirePermission(consts.PermCustomerManage), handler.AdminReassignCustomers)
+
+		admin.PUT("/house/update/info/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.ModifyPropertyBaseInfo)
+		admin.PUT("/house/update/image/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.ModifyPropertyImage)
+		admin.PUT("/house/update/richtext/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.ModifyPropertyRichText)
+		admin.DELETE("/house/delete/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.DeleteProperty)
+		admin.POST("/house/image/add/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.AddPropertyImage)
+		admin.PUT("/house/image/update/:houseID/:imageID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.ModifyPropertyImageInfo)
+		admin.DELETE("/house/image/delete/:houseID/:imageID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.DeletePropertyImage)
+		admin.PUT("/house/image/order/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.ReorderPropertyImages)
+		admin.POST("/house/upload/presign/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.PresignUpload)
+		admin.POST("/house/upload/confirm/:houseID", middleware.RequirePermission(consts.PermPropertyManageAll), handler.ConfirmUpload)
 	}
 
 	house := R.Group("/house")
 	house.Use(middleware.JWTAuth(consts.User))
 	{
-		house.POST("/create/info", handler.CreatePropertyBaseInfo)
-		house.POST("/create/image/:houseID", handler.CreatePropertyImage)
-		house.POST("/create/richtext/:houseID", handler.CreatePropertyRichText)
-		house.GET("/info/:houseID", handler.GetPropertyByID)
-		house.GET("/list", handler.ListProperty)
-		house.POST("/select", handler.SelectProperties)
-		house.GET("/search", handler.SearchPropertyByAddr)
-		house.PUT("/update/info/:houseID", handler.ModifyPropertyBaseInfo)
-		house.PUT("/update/image/:houseID", handler.ModifyPropertyImage)
-		house.PUT("/update/richtext/:houseID", handler.ModifyPropertyRichText)
-		house.DELETE("/delete/:houseID", handler.DeleteProperty)
+		house.POST("/create/info", middleware.RequirePermission(consts.PermPropertyCreate), handler.CreatePropertyBaseInfo)
+		house.POST("/create/image/:houseID", middleware.RequirePermission(consts.PermPropertyCreate), handler.CreatePropertyImage)
+		house.POST("/create/richtext/:houseID", middleware.RequirePermission(consts.PermPropertyCreate), handler.CreatePropertyRichText)
+		house.GET("/info/:houseID", middleware.RequirePermission(consts.PermPropertyView), handler.GetPropertyByID)
+		house.GET("/list", middleware.RequirePermission(consts.PermPropertyView), handler.ListProperty)
+		house.POST("/select", middleware.RequirePermission(consts.PermPropertyView), handler.SelectProperties)
+		house.POST("/facets", middleware.RequirePermission(consts.PermPropertyView), handler.GetPropertyFacets)
+		house.GET("/search", middleware.RequirePermission(consts.PermPropertyView), handler.SearchPropertyByAddr)
+		house.GET("/price_drops", middleware.RequirePermission(consts.PermPropertyView), handler.ListPriceDrops)
+		house.GET("/buckets", middleware.RequirePermission(consts.PermPropertyView), handler.ListBuckets)
+		house.GET("/map/radius", middleware.RequirePermission(consts.PermPropertyView), handler.SearchPropertiesByRadius)
+		house.GET("/map/box", middleware.RequirePermission(consts.PermPropertyView), handler.SearchPropertiesByBox)
+		house.PUT("/update/info/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ModifyPropertyBaseInfo)
+		house.PUT("/update/image/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ModifyPropertyImage)
+		house.PUT("/update/richtext/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ModifyPropertyRichText)
+		house.DELETE("/delete/:houseID", middleware.RequirePermission(consts.PermPropertyDelete), handler.DeleteProperty)
+		house.POST("/image/add/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.AddPropertyImage)
+		house.PUT("/image/update/:houseID/:imageID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ModifyPropertyImageInfo)
+		house.DELETE("/image/delete/:houseID/:imageID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.DeletePropertyImage)
+		house.PUT("/image/order/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ReorderPropertyImages)
+		house.POST("/upload/presign/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.PresignUpload)
+		house.POST("/upload/confirm/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ConfirmUpload)
+		house.PUT("/status/:houseID", middleware.RequirePermission(consts.PermPropertyUpdate), handler.ModifyPropertyStatus)
+		house.GET("/match/:houseID", middleware.RequirePermission(consts.PermCustomerView), handler.MatchCustomersForProperty)
+
+		house.POST("/saved_search", middleware.RequirePermission(consts.PermPropertyView), handler.CreateSavedSearch)
+		house.GET("/saved_search/list", middleware.RequirePermission(consts.PermPropertyView), handler.ListSavedSearches)
+		house.PUT("/saved_search/:id", middleware.RequirePermission(consts.PermPropertyView), handler.ModifySavedSearch)
+		house.DELETE("/saved_search/:id", middleware.RequirePermission(consts.PermPropertyView), handler.DeleteSavedSearch)
+		house.GET("/saved_search/:id/run", middleware.RequirePermission(consts.PermPropertyView), handler.RunSavedSearch)
 	}
 
 	customer := R.Group("/customer")
 	customer.Use(middleware.JWTAuth(consts.User))
 	{
-		customer.POST("/create", handler.CreateCustomer)
-		customer.GET("/list", handler.UserListCustomers)
+		customer.POST("/create", middleware.RequirePermission(consts.PermCustomerCreate), handler.CreateCustomer)
+		customer.GET("/list", middleware.RequirePermission(consts.PermCustomerView), handler.UserListCustomers)
+		customer.PUT("/requirement/:customer_id", middleware.RequirePermission(consts.PermCustomerCreate), handler.SetCustomerRequirement)
+		customer.GET("/requirement/:customer_id", middleware.RequirePermission(consts.PermCustomerView), handler.GetCustomerRequirement)
+		customer.GET("/match/:customer_id", middleware.RequirePermission(consts.PermPropertyView), handler.MatchPropertiesForCustomer)
+		customer.POST("/follow_up/:customer_id", middleware.RequirePermission(consts.PermCustomerCreate), handler.CreateFollowUp)
+		customer.GET("/follow_up/:customer_id", middleware.RequirePermission(consts.PermCustomerView), handler.ListFollowUps)
+	}
+
+	appointment := R.Group("/appointment")
+	appointment.Use(middleware.JWTAuth(consts.User))
+	{
+		appointment.POST("/create", middleware.RequirePermission(consts.PermCustomerCreate), handler.CreateAppointment)
+		appointment.PUT("/update/:id", middleware.RequirePermission(consts.PermCustomerCreate), handler.ModifyAppointment)
+		appointment.GET("/agenda", middleware.RequirePermission(consts.PermCustomerView), handler.GetMyAgenda)
 	}
 }
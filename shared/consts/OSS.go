@@ -1,7 +1,20 @@
 package consts
 
+import "time"
+
 const (
 	OSSRootUrl      = "house-backend-oss"
 	DefaultImageUrl = "https://objectstorageapi.hzh.sealos.run/tjv8mfu2-house/house-backend-oss/house.png"
 	DefaultHTMLUrl  = "https://objectstorageapi.hzh.sealos.run/tjv8mfu2-house/house-backend-oss/defaultRichText.html"
+
+	// 直传 (预签名 URL) 的临时目录, 确认后会重新编码到 images/html 目录并删除临时文件
+	OSSUploadCategory = "uploads"
+	PresignExpire     = 15 * time.Minute
+	DirectUploadLimit = 10 * MB
+
+	// 孤儿文件清理的最短宽限期, 避免删掉刚上传还没写入数据库的文件
+	OSSGCMinGrace = time.Hour
+
+	UploadKindImage    = "image"
+	UploadKindRichText = "richtext"
 )
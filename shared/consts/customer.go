@@ -0,0 +1,15 @@
+package consts
+
+// 客户跟进方式
+const (
+	FollowUpCall  = "call"
+	FollowUpVisit = "visit" // 到店或上门
+	FollowUpNote  = "note"
+)
+
+// 带看预约状态
+const (
+	AppointmentScheduled = "scheduled"
+	AppointmentCompleted = "completed"
+	AppointmentCancelled = "cancelled"
+)
@@ -1,9 +1,22 @@
 package consts
 
 const (
-	UserTable          = "users"
-	PropertyTable      = "properties"
-	PropertyImageTable = "property_images"
-	InviteCodeTable    = "invite_codes"
-	CustomerTable      = "customers"
+	UserTable                 = "users"
+	PropertyTable             = "properties"
+	PropertyImageTable        = "property_images"
+	InviteCodeTable           = "invite_codes"
+	CustomerTable             = "customers"
+	InviteRedemptionTable     = "invite_redemptions"
+	SessionTable              = "sessions"
+	UsedRefreshTokenTable     = "used_refresh_tokens"
+	AuditLogTable             = "audit_logs"
+	PropertyPriceHistoryTable = "property_price_histories"
+	PropertyStatusTable       = "property_status_transitions"
+	CustomerRequirementTable  = "customer_requirements"
+	SavedSearchTable          = "saved_searches"
+	NotificationTable         = "notifications"
+	CustomerFollowUpTable     = "customer_follow_ups"
+	AppointmentTable          = "appointments"
+	PropertySearchDocTable    = "property_search_docs"
+	FilterBucketTable         = "filter_buckets"
 )
@@ -1,8 +1,10 @@
 package consts
 
 const (
-	DBEnvFile     = "./db/.env"
-	OSSEnvFIle    = "./utils/OSS/.env"
-	AdminPassFile = "./config/.admin"
-	JWTKeyFile    = "./utils/jwt/.key"
+	DBEnvFile  = "./db/.env"
+	OSSEnvFIle = "./utils/OSS/.env"
+	JWTKeyFile = "./utils/jwt/.key"
+
+	DivisionFile   = "./utils/division/divisions.json"
+	GeoFixtureFile = "./utils/geo/fixture.json"
 )
@@ -0,0 +1,10 @@
+package consts
+
+// 房源状态
+const (
+	PropertyStatusDraft     = "draft"
+	PropertyStatusActive    = "active"
+	PropertyStatusReserved  = "reserved" // 已有意向, 正在谈
+	PropertyStatusSold      = "sold"
+	PropertyStatusWithdrawn = "withdrawn" // 下架
+)
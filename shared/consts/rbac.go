@@ -0,0 +1,27 @@
+package consts
+
+const (
+	RoleAdmin    = Admin
+	RoleTeamLead = "team_lead"
+	RoleAgent    = "agent"
+	RoleViewer   = "viewer"
+	RoleUser     = User // 旧版本注册的默认角色, 权限等同 agent
+)
+
+const (
+	PermPropertyView      = "property:view"
+	PermPropertyCreate    = "property:create"
+	PermPropertyUpdate    = "property:update"
+	PermPropertyDelete    = "property:delete"
+	PermPropertyManageAll = "property:manage_all" // 修改、删除他人的房源
+
+	PermCustomerView      = "customer:view"
+	PermCustomerCreate    = "customer:create"
+	PermCustomerViewPhone = "customer:view_phone" // 查看他人客户的电话
+	PermCustomerManage    = "customer:manage"     // 修改、删除、转移客户
+
+	PermUserView     = "user:view"
+	PermUserManage   = "user:manage" // 删除用户、分配角色
+	PermInviteManage = "invite:manage"
+	PermAuditView    = "audit:view"
+)
@@ -0,0 +1,102 @@
+package enum
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// 房源编码字段的取值和中英文名称, 前端和服务端共用 labels.json 这一份定义
+// 修改取值或名称时只改 labels.json, 并同步给前端
+//
+//go:embed labels.json
+var labelData []byte
+
+const (
+	LangZh = "zh"
+	LangEn = "en"
+)
+
+type Option struct {
+	Value int    `json:"value"`
+	Zh    string `json:"zh"`
+	En    string `json:"en"`
+}
+
+type Enum struct {
+	Name    string   `json:"name"` // 中文名称, 用于错误提示
+	Options []Option `json:"options"`
+}
+
+// Valid 取值从 1 开始连续编号
+func (e Enum) Valid(value int) bool {
+	return value >= 1 && value <= len(e.Options)
+}
+
+func (e Enum) Max() int {
+	return len(e.Options)
+}
+
+// Label 返回取值对应的名称, 不存在时返回空字符串
+func (e Enum) Label(value int, lang string) string {
+	if !e.Valid(value) {
+		return ""
+	}
+	option := e.Options[value-1]
+	if lang == LangEn {
+		return option.En
+	}
+	return option.Zh
+}
+
+// fields 请求中的字段名, labels.json 必须包含且只包含这些字段
+var fields = []string{"direction", "renovation", "room", "special", "subjectmatter"}
+
+// load 解析并检查 labels.json, 取值必须从 1 开始连续编号, 中英文名称都不能为空
+func load(data []byte) (map[string]Enum, error) {
+	var all map[string]Enum
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse enum labels: %w", err)
+	}
+	if len(all) != len(fields) {
+		return nil, fmt.Errorf("enum labels should define exactly %v", fields)
+	}
+
+	for _, field := range fields {
+		e, ok := all[field]
+		if !ok {
+			return nil, fmt.Errorf("enum labels missing field %s", field)
+		}
+		if e.Name == "" || len(e.Options) == 0 {
+			return nil, fmt.Errorf("enum %s should have a name and options", field)
+		}
+		for i, option := range e.Options {
+			if option.Value != i+1 {
+				return nil, fmt.Errorf("enum %s: value %d should be %d", field, option.Value, i+1)
+			}
+			if option.Zh == "" || option.En == "" {
+				return nil, fmt.Errorf("enum %s: value %d missing zh or en label", field, option.Value)
+			}
+		}
+	}
+	return all, nil
+}
+
+func mustLoad(data []byte) map[string]Enum {
+	all, err := load(data)
+	if err != nil {
+		panic(err)
+	}
+	return all
+}
+
+// All key 与请求中的字段名一致
+var All = mustLoad(labelData)
+
+var (
+	Direction     = All["direction"]
+	Renovation    = All["renovation"]
+	Room          = All["room"]
+	Special       = All["special"]
+	SubjectMatter = All["subjectmatter"]
+)
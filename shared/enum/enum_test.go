@@ -0,0 +1,55 @@
+package enum
+
+import "testing"
+
+func TestLabelsFile(t *testing.T) {
+	counts := map[string]int{
+		"direction":     10,
+		"renovation":    4,
+		"room":          11,
+		"special":       5,
+		"subjectmatter": 4,
+	}
+	for field, n := range counts {
+		if got := All[field].Max(); got != n {
+			t.Errorf("%s: got %d values, want %d", field, got, n)
+		}
+	}
+
+	if got := Direction.Label(2, LangEn); got != "South" {
+		t.Errorf("Direction.Label(2, en) = %q", got)
+	}
+	if got := Room.Label(0, LangZh); got != "" {
+		t.Errorf("Room.Label(0, zh) = %q, want empty", got)
+	}
+}
+
+func TestLoadRejectsInvalidLabels(t *testing.T) {
+	valid := `"renovation": {"name": "装修状态", "options": [{"value": 1, "zh": "毛坯", "en": "Unfurnished"}]},
+		"room": {"name": "房间类型", "options": [{"value": 1, "zh": "一室", "en": "Studio"}]},
+		"special": {"name": "特殊类型", "options": [{"value": 1, "zh": "无", "en": "None"}]},
+		"subjectmatter": {"name": "标的物类型", "options": [{"value": 1, "zh": "住宅", "en": "Residential"}]}`
+
+	tests := []struct {
+		name      string
+		direction string
+		wantErr   bool
+	}{
+		{"valid", `{"name": "朝向", "options": [{"value": 1, "zh": "东", "en": "East"}]}`, false},
+		{"not starting from 1", `{"name": "朝向", "options": [{"value": 2, "zh": "东", "en": "East"}]}`, true},
+		{"missing en", `{"name": "朝向", "options": [{"value": 1, "zh": "东"}]}`, true},
+		{"no options", `{"name": "朝向", "options": []}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load([]byte(`{"direction": ` + tt.direction + `, ` + valid + `}`))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := load([]byte(`{` + valid + `}`)); err == nil {
+		t.Error("load() should reject missing direction")
+	}
+}
@@ -1,13 +1,18 @@
 package OSS
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/imaging"
 	"github.com/minio/minio-go/v7"
 	"io"
 	"mime/multipart"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -36,63 +41,124 @@ func UploadFileToOSS(ctx context.Context, category string, objectName string, fi
 	return GetFileURL(fullObjectName), nil
 }
 
-func UploadImageToOSS(ctx context.Context, file *multipart.FileHeader) (string, error) {
+// uniqueObjectBase 时间 + 原文件名 + 随机后缀, 不含扩展名
+// 扩展名会被统一替换, 同一秒内上传 a.png 和 a.jpg 也不能互相覆盖
+func uniqueObjectBase(filename string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	stem := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return fmt.Sprintf("%s-%s-%s", time.Now().Format("20060102150405"), stem, hex.EncodeToString(random)), nil
+}
+
+// ImageURLs 一张图片各尺寸的地址
+type ImageURLs struct {
+	URL          string
+	MediumURL    string
+	ThumbnailURL string
+}
+
+// UploadImageToOSS 文件内容不合法时返回的错误包含 ErrInvalidFile
+func UploadImageToOSS(ctx context.Context, file *multipart.FileHeader) (*ImageURLs, error) {
 
 	const maxFileSize = consts.TreeMB
 	if file.Size > maxFileSize {
-		return "", fmt.Errorf("file size should less than 3MB")
+		return nil, fmt.Errorf("%w: file size should less than 3MB", ErrInvalidFile)
+	}
+
+	// 打开文件
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("file to open image: %w", err)
 	}
+	defer src.Close()
 
+	data, err := io.ReadAll(io.LimitReader(src, maxFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("file to read image: %w", err)
+	}
+
+	return UploadImageBytesToOSS(ctx, file.Filename, data)
+}
+
+// UploadImageBytesToOSS 校验并重新编码已读入内存的图片, 再上传各尺寸
+func UploadImageBytesToOSS(ctx context.Context, filename string, data []byte) (*ImageURLs, error) {
 	category := "images"
 
-	ext := filepath.Ext(file.Filename)
-	contentType := "application/octet-stream"
-
-	switch ext {
-	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
-	case ".png":
-		contentType = "image/png"
-	case ".gif":
-		contentType = "image/gif"
-	case ".webp":
-		contentType = "image/webp"
-	case ".bmp":
-		contentType = "image/bmp"
-	case ".svg":
-		contentType = "image/svg+xml"
-	default:
-		return "", fmt.Errorf("not suppot image type：%s，only support jpg/jpeg/png/gif/webp/bmp/svg", ext)
+	if _, err := sniffImage(data); err != nil {
+		return nil, err
 	}
 
-	// 打开文件
-	src, err := file.Open()
+	// 重新编码, 去掉 EXIF/GPS 等元数据并生成缩略图和中图
+	processed, err := imaging.Process(data)
 	if err != nil {
-		return "", fmt.Errorf("file to open image: %w", err)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFile, err.Error())
 	}
 
-	// 生成唯一的文件名
-	objectName := fmt.Sprintf("%s-%s", time.Now().Format("20060102150405"), file.Filename)
+	// 生成唯一的文件名, 各尺寸共用前缀
+	base, err := uniqueObjectBase(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := &ImageURLs{}
+	for _, variant := range []struct {
+		suffix string
+		data   []byte
+		url    *string
+	}{
+		{"", processed.Large, &urls.URL},
+		{"-medium", processed.Medium, &urls.MediumURL},
+		{"-thumb", processed.Thumbnail, &urls.ThumbnailURL},
+	} {
+		objectName := base + variant.suffix + imaging.Ext
+		url, err := UploadFileToOSS(ctx, category, objectName, bytes.NewReader(variant.data), int64(len(variant.data)), imaging.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		*variant.url = url
+	}
 
-	return UploadFileToOSS(ctx, category, objectName, src, file.Size, contentType)
+	return urls, nil
 }
 
+// UploadHTMLToOSS 按白名单清理后再上传, 文件内容不合法时返回的错误包含 ErrInvalidFile
 func UploadHTMLToOSS(ctx context.Context, file *multipart.FileHeader) (string, error) {
 
 	const maxFileSize = consts.TreeMB
 	if file.Size > maxFileSize {
-		return "", fmt.Errorf("file size should less than 3MB")
+		return "", fmt.Errorf("%w: file size should less than 3MB", ErrInvalidFile)
 	}
 
-	category := "html"
-	contextType := "text/html"
-
 	src, err := file.Open()
 	if err != nil {
 		return "", fmt.Errorf("file to open html: %w", err)
 	}
+	defer src.Close()
 
-	// 生成唯一的文件名
-	objectName := fmt.Sprintf("%s-%s", time.Now().Format("20060102150405"), file.Filename)
-	return UploadFileToOSS(ctx, category, objectName, src, file.Size, contextType)
+	data, err := io.ReadAll(io.LimitReader(src, maxFileSize))
+	if err != nil {
+		return "", fmt.Errorf("file to read html: %w", err)
+	}
+
+	return UploadHTMLBytesToOSS(ctx, file.Filename, data)
+}
+
+// UploadHTMLBytesToOSS 清理已读入内存的富文本后上传
+func UploadHTMLBytesToOSS(ctx context.Context, filename string, data []byte) (string, error) {
+	category := "html"
+	contextType := "text/html; charset=utf-8"
+
+	sanitized, err := sanitizeHTML(data)
+	if err != nil {
+		return "", err
+	}
+
+	// 生成唯一的文件名, 统一使用 .html 扩展名
+	base, err := uniqueObjectBase(filename)
+	if err != nil {
+		return "", err
+	}
+	return UploadFileToOSS(ctx, category, base+".html", bytes.NewReader(sanitized), int64(len(sanitized)), contextType)
 }
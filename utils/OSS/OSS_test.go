@@ -0,0 +1,26 @@
+package OSS
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUniqueObjectBase(t *testing.T) {
+	seen := make(map[string]bool)
+	// 扩展名不同但文件名相同, 以及手机上常见的 image.jpg
+	for _, filename := range []string{"a.png", "a.jpg", "image.jpg", "image.jpg", "house-backend-oss/uploads/1/2/x.webp"} {
+		base, err := uniqueObjectBase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[base] {
+			t.Errorf("uniqueObjectBase(%q) = %q, already generated", filename, base)
+		}
+		seen[base] = true
+
+		stem := strings.TrimSuffix(filename[strings.LastIndex(filename, "/")+1:], filename[strings.LastIndex(filename, "."):])
+		if !strings.Contains(base, "-"+stem+"-") || strings.Contains(base, "/") {
+			t.Errorf("uniqueObjectBase(%q) = %q, should keep the stem %q without directories", filename, base, stem)
+		}
+	}
+}
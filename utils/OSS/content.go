@@ -0,0 +1,61 @@
+package OSS
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"net/http"
+	"unicode/utf8"
+)
+
+// ErrInvalidFile 上传的文件内容不合法, 调用方应返回 400 而不是 500
+var ErrInvalidFile = errors.New("invalid file")
+
+// 按文件头识别的图片类型, 不信任文件扩展名
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// sniffImage 根据文件头判断图片类型, SVG 可以内嵌脚本, 一律拒绝
+func sniffImage(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if allowedImageTypes[contentType] {
+		return contentType, nil
+	}
+
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+		return "", fmt.Errorf("%w: svg images are not supported, only support jpg/jpeg/png/gif/webp/bmp", ErrInvalidFile)
+	}
+	return "", fmt.Errorf("%w: file content is %s, not a supported image, only support jpg/jpeg/png/gif/webp/bmp", ErrInvalidFile, contentType)
+}
+
+// richTextPolicy 富文本白名单, 在用户内容策略的基础上允许编辑器常用的行内样式
+var richTextPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowStyles("color", "background-color", "text-align", "font-size", "font-weight", "font-style", "text-decoration").Globally()
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// sanitizeHTML 检查富文本是 UTF-8 编码的 HTML, 去掉脚本、事件属性等白名单以外的内容
+func sanitizeHTML(data []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%w: rich text is empty", ErrInvalidFile)
+	}
+	if contentType := http.DetectContentType(data); !bytes.HasPrefix([]byte(contentType), []byte("text/")) {
+		return nil, fmt.Errorf("%w: file content is %s, rich text must be an html file", ErrInvalidFile, contentType)
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: rich text must be utf-8 encoded", ErrInvalidFile)
+	}
+	return richTextPolicy.SanitizeBytes(data), nil
+}
@@ -0,0 +1,152 @@
+package OSS
+
+import (
+	"bytes"
+	"errors"
+	"github.com/hewo233/house-system-backend/utils/imaging"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodeTestImage(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniffImage(t *testing.T) {
+	pngData := encodeTestImage(t, func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) })
+	jpegData := encodeTestImage(t, func(w *bytes.Buffer, img image.Image) error { return jpeg.Encode(w, img, nil) })
+	gifData := encodeTestImage(t, func(w *bytes.Buffer, img image.Image) error { return gif.Encode(w, img, nil) })
+
+	tests := []struct {
+		name string
+		data []byte
+		want string // 为空时应返回 ErrInvalidFile
+	}{
+		{"png", pngData, "image/png"},
+		{"jpeg", jpegData, "image/jpeg"},
+		{"gif", gifData, "image/gif"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), "image/webp"},
+		{"bmp", []byte("BM\x3a\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00"), "image/bmp"},
+		// 按文件头判断, 扩展名和声明的类型都不参与
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"></svg>`), ""},
+		{"svg in xml", []byte(`<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), ""},
+		{"svg with doctype", []byte("\n  <!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\">\n<SVG></SVG>"), ""},
+		{"html", []byte(`<html><img src=x onerror="alert(1)"></html>`), ""},
+		{"html before gif header", append([]byte("<script>alert(1)</script>"), gifData...), ""},
+		{"text", []byte("not an image"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		got, err := sniffImage(tt.data)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("%s: sniffImage() = %q, %v, want ErrInvalidFile", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: sniffImage() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	// GIF 文件头后面拼接 HTML 的 polyglot 能通过类型检查, 但重新编码后只剩像素, 脚本不会保留到上传的文件中
+	polyglot := append(append([]byte{}, gifData...), []byte("<script>alert(1)</script>")...)
+	if _, err := sniffImage(polyglot); err != nil {
+		t.Fatalf("sniffImage(gif/html polyglot) = %v, want image/gif", err)
+	}
+	processed, err := imaging.Process(polyglot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, variant := range [][]byte{processed.Large, processed.Medium, processed.Thumbnail} {
+		if bytes.Contains(variant, []byte("<script")) {
+			t.Error("re-encoded gif/html polyglot still contains the script")
+		}
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		keep    []string // 清理后应保留的内容
+		drop    []string // 清理后不应出现的内容
+		wantErr bool
+	}{
+		{
+			name:  "script",
+			input: `<p>三室两厅</p><script>alert(document.cookie)</script>`,
+			keep:  []string{"<p>三室两厅</p>"},
+			drop:  []string{"<script", "alert"},
+		},
+		{
+			name:  "event attributes",
+			input: `<img src="https://example.com/a.jpg" onerror="alert(1)"><p onclick="alert(2)">近地铁</p>`,
+			keep:  []string{`src="https://example.com/a.jpg"`, "近地铁"},
+			drop:  []string{"onerror", "onclick", "alert"},
+		},
+		{
+			name:  "javascript href",
+			input: `<a href="javascript:alert(1)">看房</a><a href=" JaVaScRiPt:alert(2)">联系</a>`,
+			keep:  []string{"看房", "联系"},
+			drop:  []string{"javascript:", "JaVaScRiPt:"},
+		},
+		{
+			name:  "iframe and style tag",
+			input: `<p>南北通透</p><iframe src="https://evil.example.com"></iframe><style>body{display:none}</style>`,
+			keep:  []string{"南北通透"},
+			drop:  []string{"<iframe", "<style"},
+		},
+		{
+			name:  "allowed inline styles",
+			input: `<p style="color: red; position: fixed">精装修</p>`,
+			keep:  []string{"color: red", "精装修"},
+			drop:  []string{"position"},
+		},
+		{
+			name:  "external links open in new tab",
+			input: `<a href="https://example.com">小区介绍</a>`,
+			keep:  []string{`target="_blank"`},
+		},
+		{name: "gbk", input: "<p>\xc4\xcf\xb1\xb1\xcd\xa8\xcd\xb8</p>", wantErr: true},
+		{name: "utf-16", input: "\xff\xfe<\x00p\x00>\x00", wantErr: true},
+		{name: "latin-1", input: "<p>caf\xe9</p>", wantErr: true},
+		{name: "gif/html polyglot", input: "GIF89a<html><script>alert(1)</script></html>", wantErr: true},
+		{name: "png", input: "\x89PNG\r\n\x1a\n<p>hi</p>", wantErr: true},
+		{name: "empty", input: " \n\t", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sanitizeHTML([]byte(tt.input))
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("%s: sanitizeHTML() error = %v, want ErrInvalidFile", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: sanitizeHTML() error = %v", tt.name, err)
+			continue
+		}
+		for _, s := range tt.keep {
+			if !strings.Contains(string(got), s) {
+				t.Errorf("%s: sanitizeHTML() = %q, should keep %q", tt.name, got, s)
+			}
+		}
+		for _, s := range tt.drop {
+			if strings.Contains(string(got), s) {
+				t.Errorf("%s: sanitizeHTML() = %q, should drop %q", tt.name, got, s)
+			}
+		}
+	}
+}
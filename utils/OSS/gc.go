@@ -0,0 +1,226 @@
+package OSS
+
+import (
+	"context"
+	"fmt"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 后端写入的目录, 只清理这些目录下的文件, 根目录下手动放置的文件 (如默认图片) 不处理
+var gcCategories = []string{"images", "html", consts.OSSUploadCategory}
+
+// 报告中最多列出的孤儿文件数量
+const gcReportLimit = 1000
+
+type GCOptions struct {
+	GracePeriod time.Duration // 上传和解除引用都早于该时长的孤儿文件才会删除, 解除引用的时间见 ReferencedURLs
+	DryRun      bool          // 只生成报告, 不删除
+}
+
+type GCObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+type GCReport struct {
+	DryRun        bool       `json:"dry_run"`
+	GracePeriod   string     `json:"grace_period"`
+	Scanned       int        `json:"scanned"`
+	Referenced    int        `json:"referenced"`
+	Protected     int        `json:"protected"`       // 默认文件和非后端目录下的文件
+	InGracePeriod int        `json:"in_grace_period"` // 未被引用但还在宽限期内
+	OrphanCount   int        `json:"orphan_count"`
+	OrphanBytes   int64      `json:"orphan_bytes"`
+	Orphans       []GCObject `json:"orphans"` // 最多 gcReportLimit 条
+	Deleted       int        `json:"deleted"`
+	Errors        []string   `json:"errors"`
+}
+
+// ObjectKey 从文件 URL 中取出 bucket 内的 object key, 不属于当前 bucket 时返回 false
+// GetFileURL 拼接的地址没有转义, 这里按字符串处理, 不用 url.Parse 解码
+func ObjectKey(fileURL string) (string, bool) {
+	rest, found := strings.CutPrefix(fileURL, "https://")
+	if !found {
+		rest, found = strings.CutPrefix(fileURL, "http://")
+	}
+	if !found {
+		return "", false
+	}
+	// 去掉域名
+	_, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(path, bucket+"/")
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+// References 房源仍在使用的文件地址, LiveProperties 为未删除的房源数量, 用于清理前的安全检查
+type References struct {
+	URLs           []string
+	LiveProperties int64
+}
+
+// 引用地址中无法解析为当前 bucket 的比例超过该值时拒绝清理
+const gcMaxUnmappedRatio = 0.1
+
+// ReferencedURLs 查询房源仍在使用的图片和富文本地址
+// 在 deletedAfter 之后才删除的图片和房源仍算作引用, 宽限期从删除时开始计算而不是从上传时
+// 替换富文本时旧地址直接被覆盖, 没有删除时间, 只能按上传时间判断
+func ReferencedURLs(database *gorm.DB, deletedAfter time.Time) (*References, error) {
+	refs := &References{}
+
+	var images []struct {
+		URL          string
+		MediumURL    string
+		ThumbnailURL string
+	}
+	err := database.Table(consts.PropertyImageTable+" AS i").
+		Joins("JOIN "+consts.PropertyTable+" AS p ON p.id = i.property_id AND (p.deleted_at IS NULL OR p.deleted_at > ?)", deletedAfter).
+		Where("(i.deleted_at IS NULL OR i.deleted_at > ?)", deletedAfter).
+		Select("i.url, i.medium_url, i.thumbnail_url").Scan(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		refs.URLs = append(refs.URLs, image.URL, image.MediumURL, image.ThumbnailURL)
+	}
+
+	var richTexts []string
+	if err := database.Table(consts.PropertyTable).Where("(deleted_at IS NULL OR deleted_at > ?) AND rich_text_url <> ''", deletedAfter).Pluck("rich_text_url", &richTexts).Error; err != nil {
+		return nil, err
+	}
+	refs.URLs = append(refs.URLs, richTexts...)
+
+	if err := database.Table(consts.PropertyTable).Where("deleted_at IS NULL").Count(&refs.LiveProperties).Error; err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// Keys 把引用地址转换为 object key
+// 大部分地址无法解析, 或者还有房源却没有任何引用时, 多半是域名或 bucket 配置变了, 返回错误, 否则会删掉所有文件
+func (r *References) Keys() (map[string]bool, error) {
+	keys := make(map[string]bool, len(r.URLs))
+	total, unmapped := 0, 0
+	for _, u := range r.URLs {
+		// 旧数据没有中图和缩略图, 默认文件另外保护
+		if u == "" || u == consts.DefaultImageUrl || u == consts.DefaultHTMLUrl {
+			continue
+		}
+		total++
+		key, ok := ObjectKey(u)
+		if !ok {
+			unmapped++
+			continue
+		}
+		keys[key] = true
+	}
+
+	if total > 0 && float64(unmapped) > float64(total)*gcMaxUnmappedRatio {
+		return nil, fmt.Errorf("%d of %d referenced urls do not belong to bucket %s, check the OSS config", unmapped, total, bucket)
+	}
+	if len(keys) == 0 && r.LiveProperties > 0 {
+		return nil, fmt.Errorf("no referenced files found while %d properties exist", r.LiveProperties)
+	}
+	return keys, nil
+}
+
+func isGCCandidate(key string) bool {
+	for _, category := range gcCategories {
+		if strings.HasPrefix(key, consts.OSSRootUrl+"/"+category+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type gcVerdict int
+
+const (
+	gcProtected gcVerdict = iota
+	gcReferenced
+	gcInGracePeriod
+	gcOrphan
+)
+
+// classifyObject 判断一个文件是否可以删除, deadline 之后上传的文件还在宽限期内
+func classifyObject(key string, lastModified time.Time, referenced map[string]bool, protected map[string]bool, deadline time.Time) gcVerdict {
+	switch {
+	case protected[key] || !isGCCandidate(key):
+		return gcProtected
+	case referenced[key]:
+		return gcReferenced
+	case lastModified.After(deadline):
+		return gcInGracePeriod
+	}
+	return gcOrphan
+}
+
+// CollectGarbage 列出 consts.OSSRootUrl 下的文件, 删除没有被引用且超过宽限期的文件
+func CollectGarbage(ctx context.Context, refs *References, opts GCOptions) (*GCReport, error) {
+	referenced, err := refs.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("refuse to collect garbage: %w", err)
+	}
+
+	// 默认图片和默认富文本无论如何都不删除
+	protected := make(map[string]bool)
+	for _, u := range []string{consts.DefaultImageUrl, consts.DefaultHTMLUrl} {
+		if key, ok := ObjectKey(u); ok {
+			protected[key] = true
+		}
+	}
+
+	report := &GCReport{
+		DryRun:      opts.DryRun,
+		GracePeriod: opts.GracePeriod.String(),
+		Orphans:     make([]GCObject, 0),
+		Errors:      make([]string, 0),
+	}
+	deadline := time.Now().Add(-opts.GracePeriod)
+
+	for object := range minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: consts.OSSRootUrl + "/", Recursive: true}) {
+		if object.Err != nil {
+			return report, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		report.Scanned++
+
+		switch classifyObject(object.Key, object.LastModified, referenced, protected, deadline) {
+		case gcProtected:
+			report.Protected++
+			continue
+		case gcReferenced:
+			report.Referenced++
+			continue
+		case gcInGracePeriod:
+			report.InGracePeriod++
+			continue
+		}
+
+		report.OrphanCount++
+		report.OrphanBytes += object.Size
+		if len(report.Orphans) < gcReportLimit {
+			report.Orphans = append(report.Orphans, GCObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+		}
+
+		if opts.DryRun {
+			continue
+		}
+		if err := RemoveObject(ctx, object.Key); err != nil {
+			report.Errors = append(report.Errors, object.Key+": "+err.Error())
+			continue
+		}
+		report.Deleted++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,134 @@
+package OSS
+
+import (
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// useBucket 测试期间替换当前 bucket
+func useBucket(t *testing.T, name string) {
+	old := bucket
+	bucket = name
+	t.Cleanup(func() { bucket = old })
+}
+
+func TestObjectKey(t *testing.T) {
+	useBucket(t, "house")
+
+	tests := []struct {
+		url    string
+		want   string
+		wantOK bool
+	}{
+		{"https://oss.example.com/house/house-backend-oss/images/a.jpg", "house-backend-oss/images/a.jpg", true},
+		{"http://127.0.0.1:9000/house/house-backend-oss/html/b.html", "house-backend-oss/html/b.html", true},
+		// GetFileURL 不转义, 文件名中的中文和空格原样保留
+		{"https://oss.example.com/house/house-backend-oss/images/20250101-客厅 1.jpg", "house-backend-oss/images/20250101-客厅 1.jpg", true},
+		{"https://oss.example.com/other/house-backend-oss/images/a.jpg", "", false},
+		{"https://oss.example.com/house-backend-oss/images/a.jpg", "", false}, // CDN 域名, 路径中没有 bucket
+		{"https://oss.example.com/house/", "", false},
+		{"https://oss.example.com", "", false},
+		{"oss.example.com/house/house-backend-oss/images/a.jpg", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ObjectKey(tt.url)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ObjectKey(%q) = %q, %v, want %q, %v", tt.url, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestIsGCCandidate(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{consts.OSSRootUrl + "/images/a.jpg", true},
+		{consts.OSSRootUrl + "/html/a.html", true},
+		{consts.OSSRootUrl + "/uploads/1/2/a.jpg", true},
+		{consts.OSSRootUrl + "/house.png", false}, // 根目录下手动放置的默认文件
+		{consts.OSSRootUrl + "/imagesx/a.jpg", false},
+		{consts.OSSRootUrl + "/images", false},
+		{"other/images/a.jpg", false},
+		{"images/a.jpg", false},
+	}
+	for _, tt := range tests {
+		if got := isGCCandidate(tt.key); got != tt.want {
+			t.Errorf("isGCCandidate(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyObject(t *testing.T) {
+	now := time.Now()
+	deadline := now.Add(-72 * time.Hour)
+	image := consts.OSSRootUrl + "/images/a.jpg"
+	referenced := map[string]bool{image: true}
+	protected := map[string]bool{consts.OSSRootUrl + "/images/default.jpg": true}
+
+	tests := []struct {
+		name         string
+		key          string
+		lastModified time.Time
+		want         gcVerdict
+	}{
+		{"referenced and old", image, now.Add(-365 * 24 * time.Hour), gcReferenced},
+		{"protected", consts.OSSRootUrl + "/images/default.jpg", now.Add(-365 * 24 * time.Hour), gcProtected},
+		{"outside gc categories", consts.OSSRootUrl + "/house.png", now.Add(-365 * 24 * time.Hour), gcProtected},
+		{"orphan uploaded recently", consts.OSSRootUrl + "/images/new.jpg", now.Add(-time.Hour), gcInGracePeriod},
+		{"orphan past grace period", consts.OSSRootUrl + "/images/old.jpg", now.Add(-73 * time.Hour), gcOrphan},
+		{"orphan staged upload", consts.OSSRootUrl + "/uploads/1/2/x.jpg", now.Add(-73 * time.Hour), gcOrphan},
+	}
+	for _, tt := range tests {
+		if got := classifyObject(tt.key, tt.lastModified, referenced, protected, deadline); got != tt.want {
+			t.Errorf("%s: classifyObject(%q) = %v, want %v", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestReferencesKeys(t *testing.T) {
+	useBucket(t, "house")
+	url := func(name string) string {
+		return "https://oss.example.com/house/" + consts.OSSRootUrl + "/images/" + name
+	}
+	cdn := func(name string) string {
+		return "https://cdn.example.com/" + consts.OSSRootUrl + "/images/" + name
+	}
+
+	tests := []struct {
+		name     string
+		refs     References
+		wantKeys int
+		wantErr  bool
+	}{
+		{"all mapped", References{URLs: []string{url("a.jpg"), url("b.jpg"), ""}, LiveProperties: 2}, 2, false},
+		{"no properties", References{}, 0, false},
+		// 只有默认图片时没有需要保留的文件, 不算配置错误
+		{"only default image", References{URLs: []string{consts.DefaultImageUrl}}, 0, false},
+		{"properties without references", References{URLs: []string{consts.DefaultImageUrl}, LiveProperties: 3}, 0, true},
+		{"bucket changed", References{URLs: []string{cdn("a.jpg"), cdn("b.jpg")}, LiveProperties: 2}, 0, true},
+		{"too many unmapped", References{URLs: []string{url("a.jpg"), cdn("b.jpg"), cdn("c.jpg")}, LiveProperties: 3}, 0, true},
+	}
+	for _, tt := range tests {
+		keys, err := tt.refs.Keys()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Keys() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(keys) != tt.wantKeys {
+			t.Errorf("%s: Keys() returned %d keys, want %d", tt.name, len(keys), tt.wantKeys)
+		}
+	}
+
+	// 少量旧地址无法解析时仍然可以清理
+	urls := []string{cdn("old.jpg")}
+	for i := 0; i < 20; i++ {
+		urls = append(urls, url(strconv.Itoa(i)+".jpg"))
+	}
+	if _, err := (&References{URLs: urls, LiveProperties: 20}).Keys(); err != nil {
+		t.Errorf("Keys() with 1 of 21 unmapped urls: %v", err)
+	}
+}
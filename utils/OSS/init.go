@@ -3,6 +3,7 @@ package OSS
 import (
 	"context"
 	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/imaging"
 	"github.com/joho/godotenv"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -21,6 +22,11 @@ func connectOSS() {
 	bucket = os.Getenv("BUCKET")
 	useSSL = os.Getenv("USE_SSL") == "true"
 
+	// 可选的公司水印图片路径, 未设置时不加水印
+	if err := imaging.LoadWatermark(os.Getenv("WATERMARK_FILE")); err != nil {
+		log.Fatal("failed to load watermark: ", err)
+	}
+
 	var err error
 	minioClient, err = minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
@@ -0,0 +1,105 @@
+package OSS
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StagedObjectPrefix 某个用户为某个房源直传的临时文件前缀, 确认时用来检查 object key 的归属
+func StagedObjectPrefix(propertyID uint, userID uint) string {
+	return path.Join(consts.OSSRootUrl, consts.OSSUploadCategory, fmt.Sprint(propertyID), fmt.Sprint(userID)) + "/"
+}
+
+// PresignedUpload 直传使用的 POST 表单, 客户端把 FormData 中的字段和名为 file 的文件一起提交到 URL
+type PresignedUpload struct {
+	ObjectKey string
+	URL       string
+	FormData  map[string]string
+}
+
+// PresignUpload 生成直传的 object key 和 POST policy, 文件名只保留扩展名, 避免路径穿越
+// policy 限定 object key、文件大小和 Content-Type, PUT 预签名无法限制大小, 不再使用
+func PresignUpload(ctx context.Context, propertyID uint, userID uint, kind string, filename string) (*PresignedUpload, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(filepath.Base(filename)))
+	objectName := StagedObjectPrefix(propertyID, userID) + time.Now().Format("20060102150405") + "-" + hex.EncodeToString(random) + ext
+
+	policy := minio.NewPostPolicy()
+	if err := policy.SetBucket(bucket); err != nil {
+		return nil, err
+	}
+	if err := policy.SetKey(objectName); err != nil {
+		return nil, err
+	}
+	if err := policy.SetExpires(time.Now().UTC().Add(consts.PresignExpire)); err != nil {
+		return nil, err
+	}
+	if err := policy.SetContentLengthRange(1, consts.DirectUploadLimit); err != nil {
+		return nil, err
+	}
+	// 图片的具体类型由客户端填写, 确认时仍按文件头检查真实类型
+	var err error
+	if kind == consts.UploadKindRichText {
+		err = policy.SetContentType("text/html")
+	} else {
+		err = policy.SetContentTypeStartsWith("image/")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	url, formData, err := minioClient.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+	return &PresignedUpload{ObjectKey: objectName, URL: url.String(), FormData: formData}, nil
+}
+
+// ReadStagedObject 检查直传的文件存在且大小合法, 读入内存
+func ReadStagedObject(ctx context.Context, objectName string, maxSize int64) ([]byte, error) {
+	info, err := minioClient.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: object not found, upload the file before confirming", ErrInvalidFile)
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+	if info.Size <= 0 {
+		return nil, fmt.Errorf("%w: uploaded file is empty", ErrInvalidFile)
+	}
+	if info.Size > maxSize {
+		return nil, fmt.Errorf("%w: file size should less than %dMB", ErrInvalidFile, maxSize/consts.MB)
+	}
+
+	object, err := minioClient.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	// 确认期间文件被覆盖
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: file size should less than %dMB", ErrInvalidFile, maxSize/consts.MB)
+	}
+	return data, nil
+}
+
+func RemoveObject(ctx context.Context, objectName string) error {
+	return minioClient.RemoveObject(ctx, bucket, objectName, minio.RemoveObjectOptions{})
+}
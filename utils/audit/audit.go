@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"github.com/hewo233/house-system-backend/utils/jwt"
+	"log"
+	"reflect"
+)
+
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionReassign = "reassign"
+	ActionRevoke   = "revoke"
+
+	EntityProperty      = "property"
+	EntityPropertyImage = "property_image"
+	EntityCustomer      = "customer"
+	EntityUser          = "user"
+	EntityInviteCode    = "invite_code"
+	EntityFilterBucket  = "filter_bucket"
+	EntityOSSObject     = "oss_object"
+)
+
+func toMap(v interface{}) (map[string]interface{}, string) {
+	if v == nil {
+		return nil, ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, ""
+	}
+	m := make(map[string]interface{})
+	// 数组等非对象类型只保存原始 JSON
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, string(data)
+	}
+	return m, string(data)
+}
+
+// diff 比较 before 和 after 的顶层字段, 返回 {"field": {"from": x, "to": y}}
+func diff(before, after interface{}) string {
+	beforeMap, beforeJSON := toMap(before)
+	afterMap, afterJSON := toMap(after)
+
+	if beforeMap == nil || afterMap == nil {
+		if beforeJSON == afterJSON {
+			return ""
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"from": json.RawMessage(orNull(beforeJSON)),
+			"to":   json.RawMessage(orNull(afterJSON)),
+		})
+		return string(data)
+	}
+
+	changes := make(map[string]interface{})
+	for k, v := range afterMap {
+		if old, ok := beforeMap[k]; !ok || !reflect.DeepEqual(old, v) {
+			changes[k] = map[string]interface{}{"from": beforeMap[k], "to": v}
+		}
+	}
+	for k, v := range beforeMap {
+		if _, ok := afterMap[k]; !ok {
+			changes[k] = map[string]interface{}{"from": v, "to": nil}
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(changes)
+	return string(data)
+}
+
+func orNull(s string) string {
+	if s == "" {
+		return "null"
+	}
+	return s
+}
+
+// Record 记录一次修改, before 或 after 为 nil 表示创建或删除
+// 写入失败只打印日志, 不影响已经完成的操作
+func Record(c *gin.Context, action string, entityType string, entityID interface{}, before interface{}, after interface{}) {
+	_, beforeJSON := toMap(before)
+	_, afterJSON := toMap(after)
+
+	entry := models.AuditLog{
+		ActorPhone: c.GetString("phone"),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     beforeJSON,
+		After:      afterJSON,
+		Diff:       diff(before, after),
+		IP:         c.ClientIP(),
+	}
+	if _, user, err := jwt.GetPhoneFromJWT(c); err == nil {
+		entry.ActorID = user.ID
+		entry.ActorPhone = user.Phone
+	}
+
+	if err := db.DB.Table(consts.AuditLogTable).Create(&entry).Error; err != nil {
+		log.Printf("failed to write audit log %s %s %v: %v\n", action, entityType, entityID, err)
+	}
+}
@@ -0,0 +1,228 @@
+package division
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"log"
+	"os"
+	"strconv"
+)
+
+// seed.json 只包含全部省级和直辖市的区县, 完整数据放在 consts.DivisionFile
+// 文件格式与 github.com/modood/Administrative-divisions-of-China 的 pca-code.json 相同
+//
+//go:embed seed.json
+var seed []byte
+
+// 已知的市辖区等占位名称, 拼接全称时跳过
+var placeholderNames = map[string]bool{
+	"市辖区": true,
+	"县":   true,
+}
+
+type Division struct {
+	Code     int         `json:"code"` // 6 位编码, 省为 xx0000, 市为 xxxx00
+	Name     string      `json:"name"`
+	Children []*Division `json:"children,omitempty"`
+}
+
+// Names 编码对应的省、市、区县名称, 没有加载的层级为空
+type Names struct {
+	Province string `json:"province"`
+	City     string `json:"city"`
+	District string `json:"district"`
+	Full     string `json:"full"`
+}
+
+type rawDivision struct {
+	Code     string         `json:"code"`
+	Name     string         `json:"name"`
+	Children []*rawDivision `json:"children"`
+}
+
+var (
+	tree  []*Division
+	index = make(map[int]*Division)
+)
+
+// normalize 把 2 位、4 位编码补齐为 6 位
+func normalize(code string) (int, error) {
+	if len(code) != 2 && len(code) != 4 && len(code) != 6 {
+		return 0, fmt.Errorf("invalid division code: %s", code)
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return 0, fmt.Errorf("invalid division code: %s", code)
+	}
+	for i := len(code); i < 6; i++ {
+		n *= 10
+	}
+	return n, nil
+}
+
+func convert(raws []*rawDivision) ([]*Division, error) {
+	result := make([]*Division, 0, len(raws))
+	for _, raw := range raws {
+		code, err := normalize(raw.Code)
+		if err != nil {
+			return nil, err
+		}
+		children, err := convert(raw.Children)
+		if err != nil {
+			return nil, err
+		}
+		d := &Division{Code: code, Name: raw.Name, Children: children}
+		if len(children) == 0 {
+			d.Children = nil
+		}
+		index[code] = d
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+func load(data []byte) error {
+	var raws []*rawDivision
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return err
+	}
+	index = make(map[int]*Division)
+	var err error
+	tree, err = convert(raws)
+	return err
+}
+
+// Init 优先加载 consts.DivisionFile, 不存在时使用内置的数据
+func Init() {
+	data, err := os.ReadFile(consts.DivisionFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatal("failed to read division file: ", err)
+		}
+		log.Println("division file not found, using built-in provinces only")
+		data = seed
+	}
+
+	if err := load(data); err != nil {
+		log.Fatal("failed to load divisions: ", err)
+	}
+
+	log.Printf("\033[32mDivisions loaded successfully, %d entries\033[0m\n", len(index))
+}
+
+func Lookup(code int) (*Division, bool) {
+	d, ok := index[code]
+	return d, ok
+}
+
+// Children code 为 0 时返回所有省级行政区
+func Children(code int) ([]*Division, bool) {
+	if code == 0 {
+		return tree, true
+	}
+	d, ok := index[code]
+	if !ok {
+		return nil, false
+	}
+	return d.Children, true
+}
+
+func Tree() []*Division {
+	return tree
+}
+
+// ancestors 返回省、市、区县三级编码, 相同的层级只返回一次
+func ancestors(code int) []int {
+	result := []int{code / 10000 * 10000}
+	if city := code / 100 * 100; city != result[0] {
+		result = append(result, city)
+	}
+	if code%100 != 0 {
+		result = append(result, code)
+	}
+	return result
+}
+
+// Validate 检查房源使用的区县编码, 只校验到已加载的层级
+// 例如只加载了省级数据时, 省份正确即可
+func Validate(code int) (bool, string) {
+	if code < 100000 || code > 999999 {
+		return false, "地区编码必须是6位数字"
+	}
+	if code%100 == 0 {
+		return false, "地区编码必须精确到区县"
+	}
+	if len(index) == 0 {
+		return true, ""
+	}
+
+	for _, c := range ancestors(code) {
+		d, ok := index[c]
+		if !ok {
+			return false, "地区编码不存在"
+		}
+		if c == code {
+			if len(d.Children) > 0 {
+				return false, "地区编码必须精确到区县"
+			}
+			return true, ""
+		}
+		if len(d.Children) == 0 {
+			return true, ""
+		}
+	}
+	return true, ""
+}
+
+// ValidateRegion 检查客户需求中的地区编码, 可以是省、市或区县
+func ValidateRegion(code int) (bool, string) {
+	if code < 100000 || code > 999999 {
+		return false, "地区编码必须是6位数字"
+	}
+	if len(index) == 0 {
+		return true, ""
+	}
+
+	for _, c := range ancestors(code) {
+		d, ok := index[c]
+		if !ok {
+			return false, "地区编码不存在"
+		}
+		if c == code || len(d.Children) == 0 {
+			return true, ""
+		}
+	}
+	return true, ""
+}
+
+// Resolve 返回编码对应的各级名称
+func Resolve(code int) Names {
+	var names Names
+	full := ""
+	for i, c := range ancestors(code) {
+		d, ok := index[c]
+		if !ok {
+			break
+		}
+		switch {
+		case i == 0:
+			names.Province = d.Name
+		case c%100 == 0:
+			names.City = d.Name
+		default:
+			names.District = d.Name
+		}
+		if !placeholderNames[d.Name] {
+			full += d.Name
+		}
+	}
+	names.Full = full
+	return names
+}
+
+// FullName 如 北京市海淀区
+func FullName(code int) string {
+	return Resolve(code).Full
+}
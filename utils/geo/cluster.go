@@ -0,0 +1,55 @@
+package geo
+
+import "math"
+
+// 每个地图瓦片划分的网格数
+const gridPerTile = 4
+
+type Point struct {
+	ID  uint
+	Lat float64
+	Lng float64
+}
+
+type Cluster struct {
+	Lat   float64 `json:"lat"` // 聚合点的平均位置
+	Lng   float64 `json:"lng"`
+	Count int     `json:"count"`
+	IDs   []uint  `json:"-"`
+}
+
+// CellSize 根据地图缩放级别返回网格边长 (度)
+func CellSize(zoom int) float64 {
+	return 360 / math.Pow(2, float64(zoom)) / gridPerTile
+}
+
+type cellKey struct {
+	x int64
+	y int64
+}
+
+// GridCluster 把落在同一网格的点聚合在一起, 返回顺序与点第一次出现的顺序一致
+func GridCluster(points []Point, cellSize float64) []*Cluster {
+	clusters := make([]*Cluster, 0)
+	cells := make(map[cellKey]*Cluster)
+
+	for _, p := range points {
+		key := cellKey{
+			x: int64(math.Floor(p.Lng / cellSize)),
+			y: int64(math.Floor(p.Lat / cellSize)),
+		}
+		cluster, ok := cells[key]
+		if !ok {
+			cluster = &Cluster{}
+			cells[key] = cluster
+			clusters = append(clusters, cluster)
+		}
+		// 增量更新平均位置
+		cluster.Count++
+		cluster.Lat += (p.Lat - cluster.Lat) / float64(cluster.Count)
+		cluster.Lng += (p.Lng - cluster.Lng) / float64(cluster.Count)
+		cluster.IDs = append(cluster.IDs, p.ID)
+	}
+
+	return clusters
+}
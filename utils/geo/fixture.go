@@ -0,0 +1,75 @@
+package geo
+
+import (
+	"encoding/json"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"log"
+	"os"
+	"strconv"
+)
+
+// FixtureGeocoder 从本地数据查询坐标, 先按完整地址查, 查不到时使用区县中心点
+type FixtureGeocoder struct {
+	addresses map[string][2]float64
+	districts map[int][2]float64
+}
+
+type fixtureFile struct {
+	Addresses map[string][2]float64 `json:"addresses"`
+	Districts map[string][2]float64 `json:"districts"` // key 为 6 位区县编码
+}
+
+func NewFixtureGeocoder(addresses map[string][2]float64, districts map[int][2]float64) *FixtureGeocoder {
+	if addresses == nil {
+		addresses = make(map[string][2]float64)
+	}
+	if districts == nil {
+		districts = make(map[int][2]float64)
+	}
+	return &FixtureGeocoder{addresses: addresses, districts: districts}
+}
+
+func (f *FixtureGeocoder) Geocode(address string, district int) (float64, float64, error) {
+	if point, ok := f.addresses[address]; ok {
+		return point[0], point[1], nil
+	}
+	if point, ok := f.districts[district]; ok {
+		return point[0], point[1], nil
+	}
+	return 0, 0, ErrNotFound
+}
+
+// LoadFixtureGeocoder 读取 consts.GeoFixtureFile
+func LoadFixtureGeocoder(path string) (*FixtureGeocoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file fixtureFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	districts := make(map[int][2]float64, len(file.Districts))
+	for code, point := range file.Districts {
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, err
+		}
+		districts[n] = point
+	}
+
+	return NewFixtureGeocoder(file.Addresses, districts), nil
+}
+
+// Init 目前只有本地数据实现, 接入地图服务时在这里替换
+func Init() {
+	fixture, err := LoadFixtureGeocoder(consts.GeoFixtureFile)
+	if err != nil {
+		log.Println("geocoder fixture not loaded: ", err)
+		return
+	}
+	SetGeocoder(fixture)
+	log.Println("\033[32mGeocoder initialized successfully\033[0m")
+}
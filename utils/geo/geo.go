@@ -0,0 +1,49 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+const earthRadius = 6371000.0 // 米
+
+var ErrNotFound = errors.New("address not found")
+
+// Geocoder 把地址转换为经纬度, 可替换为高德、百度等服务
+type Geocoder interface {
+	Geocode(address string, district int) (float64, float64, error)
+}
+
+var geocoder Geocoder = NewFixtureGeocoder(nil, nil)
+
+func SetGeocoder(g Geocoder) {
+	geocoder = g
+}
+
+func Geocode(address string, district int) (float64, float64, error) {
+	return geocoder.Geocode(address, district)
+}
+
+func ValidCoordinate(lat float64, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Distance 两点之间的球面距离, 单位米
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// BoundingBox 返回包含以 (lat, lng) 为圆心 radius 米的圆的矩形, 用于数据库预筛选
+func BoundingBox(lat, lng, radius float64) (minLat, minLng, maxLat, maxLng float64) {
+	dLat := radius / earthRadius * 180 / math.Pi
+	dLng := dLat / math.Cos(toRadians(lat))
+	return lat - dLat, lng - dLng, lat + dLat, lng + dLng
+}
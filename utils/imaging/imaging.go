@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	_ "golang.org/x/image/bmp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	LargeSize     = 2048 // 原图最长边, 超过时缩小
+	MediumSize    = 1024
+	ThumbnailSize = 320
+
+	// 解码前检查像素数, 防止小文件解压出超大图片, 2400 万像素足够覆盖手机和相机照片
+	maxPixels = 24_000_000
+
+	quality = 85
+
+	ContentType = "image/jpeg"
+	Ext         = ".jpg"
+)
+
+// Result 重新编码后的图片, 都是 JPEG, 不包含 EXIF 等元数据
+type Result struct {
+	Large     []byte
+	Medium    []byte
+	Thumbnail []byte
+	Width     int // Large 的尺寸
+	Height    int
+}
+
+// Process 解码上传的图片, 按 EXIF 方向旋转后生成各尺寸, 重新编码时丢弃所有元数据 (包括 GPS)
+func Process(data []byte) (*Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image dimensions %dx%d not supported", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// 先缩小再铺底色和旋转, 避免按原图尺寸复制像素
+	large := image.Image(orient(flatten(fit(src, LargeSize)), exifOrientation(data)))
+	medium := fit(large, MediumSize)
+	thumbnail := fit(medium, ThumbnailSize)
+
+	// 缩略图太小, 不加水印
+	if mark := watermark; mark != nil {
+		large = applyWatermark(large, mark)
+		medium = applyWatermark(medium, mark)
+	}
+
+	result := &Result{Width: large.Bounds().Dx(), Height: large.Bounds().Dy()}
+	for _, v := range []struct {
+		img image.Image
+		dst *[]byte
+	}{
+		{large, &result.Large},
+		{medium, &result.Medium},
+		{thumbnail, &result.Thumbnail},
+	} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, v.img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode image: %w", err)
+		}
+		*v.dst = buf.Bytes()
+	}
+	return result, nil
+}
+
+// flatten 把透明背景铺成白色, JPEG 不支持透明通道
+func flatten(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+	return dst
+}
+
+// fit 等比缩小到最长边不超过 size, 不放大
+func fit(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, xdraw.Src, nil)
+	return dst
+}
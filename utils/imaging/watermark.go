@@ -0,0 +1,63 @@
+package imaging
+
+import (
+	"fmt"
+	xdraw "golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+)
+
+const (
+	watermarkRatio   = 5   // 水印宽度为图片宽度的 1/5
+	watermarkOpacity = 160 // 0-255
+	watermarkMargin  = 16
+)
+
+var watermark image.Image
+
+// LoadWatermark 加载公司水印 (建议使用透明背景的 PNG), path 为空时不加水印
+func LoadWatermark(path string) error {
+	if path == "" {
+		watermark = nil
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open watermark: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode watermark: %w", err)
+	}
+	watermark = img
+	return nil
+}
+
+// applyWatermark 把水印缩放后半透明地画在右下角
+func applyWatermark(src image.Image, mark image.Image) image.Image {
+	bounds := src.Bounds()
+	markBounds := mark.Bounds()
+	if markBounds.Dx() == 0 || markBounds.Dy() == 0 {
+		return src
+	}
+
+	w := bounds.Dx() / watermarkRatio
+	h := w * markBounds.Dy() / markBounds.Dx()
+	if w < 1 || h < 1 || w+watermarkMargin > bounds.Dx() || h+watermarkMargin > bounds.Dy() {
+		return src
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), mark, markBounds, xdraw.Src, nil)
+
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+
+	at := image.Rect(bounds.Dx()-w-watermarkMargin, bounds.Dy()-h-watermarkMargin, bounds.Dx()-watermarkMargin, bounds.Dy()-watermarkMargin)
+	draw.DrawMask(dst, at, scaled, image.Point{}, image.NewUniform(color.Alpha{A: watermarkOpacity}), image.Point{}, draw.Over)
+	return dst
+}
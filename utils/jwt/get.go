@@ -10,8 +10,11 @@ import (
 func GetPhoneFromJWT(c *gin.Context) (string, *models.User, error) {
 	phone := c.GetString("phone")
 
-	if phone == "admin" {
-		return phone, nil, nil
+	// 同一个请求中只查询一次
+	if cached, ok := c.Get("user"); ok {
+		if user, ok := cached.(*models.User); ok && user.Phone == phone {
+			return user.Phone, user, nil
+		}
 	}
 
 	user := models.NewUser()
@@ -24,5 +27,7 @@ func GetPhoneFromJWT(c *gin.Context) (string, *models.User, error) {
 		return "", nil, errors.New("user not found")
 	}
 
+	c.Set("user", user)
+
 	return user.Phone, user, nil
 }
@@ -43,14 +43,16 @@ func InitJWTKey() {
 }
 
 type Claims struct {
+	SessionID uint `json:"sid"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(phone string, audience string) (string, error) {
+func GenerateJWT(phone string, audience string, sessionID uint) (string, error) {
 	nowTime := time.Now()
-	expireTime := nowTime.Add(consts.ThreeDays)
+	expireTime := nowTime.Add(consts.AccessTokenExpire)
 
 	claims := &Claims{
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expireTime.Unix(),
 			Audience:  audience,
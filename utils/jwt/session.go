@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused 已轮换的 refresh token 被再次使用, 会话已被撤销
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession 登录时创建会话, 返回 access token 和 refresh token
+func CreateSession(subject string, audience string) (string, string, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	session := models.Session{
+		Subject:          subject,
+		Audience:         audience,
+		RefreshTokenHash: hash,
+		ExpiresAt:        time.Now().Add(consts.RefreshTokenExpire),
+	}
+	if err := db.DB.Table(consts.SessionTable).Create(&session).Error; err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := GenerateJWT(subject, audience, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// revokeReusedSession 已轮换的 refresh token 被再次使用时, 无法区分谁是合法用户, 撤销整个会话
+func revokeReusedSession(hash string) (bool, error) {
+	var used models.UsedRefreshToken
+	result := db.DB.Table(consts.UsedRefreshTokenTable).Where("token_hash = ?", hash).Limit(1).Find(&used)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	err := db.DB.Table(consts.SessionTable).
+		Where("id = ? AND revoked_at IS NULL", used.SessionID).
+		Update("revoked_at", time.Now()).Error
+	return true, err
+}
+
+// RefreshSession 用 refresh token 换取新的 access token, 同时轮换 refresh token
+// 使用已轮换的 refresh token 视为令牌被盗, 撤销会话并返回 ErrRefreshTokenReused
+func RefreshSession(refreshToken string) (string, string, error) {
+	hash := hashRefreshToken(refreshToken)
+
+	session := models.NewSession()
+	result := db.DB.Table(consts.SessionTable).Where("refresh_token_hash = ?", hash).Limit(1).Find(session)
+	if result.Error != nil {
+		return "", "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		reused, err := revokeReusedSession(hash)
+		if err != nil {
+			return "", "", err
+		}
+		if reused {
+			return "", "", ErrRefreshTokenReused
+		}
+		return "", "", ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// 以旧哈希为条件更新, 同一个 refresh token 只能使用一次
+		result := tx.Table(consts.SessionTable).
+			Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, hash).
+			Updates(map[string]interface{}{
+				"refresh_token_hash": newHash,
+				"expires_at":         time.Now().Add(consts.RefreshTokenExpire),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		// 并发请求已经先轮换了这个 refresh token
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		return tx.Table(consts.UsedRefreshTokenTable).Create(&models.UsedRefreshToken{SessionID: session.ID, TokenHash: hash}).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := db.DB.Table(consts.SessionTable).Where("id = ? AND revoked_at IS NULL", session.ID).Update("revoked_at", time.Now()).Error; err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := GenerateJWT(session.Subject, session.Audience, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, newToken, nil
+}
+
+// RevokeSessionByRefreshToken 登出时撤销 refresh token 对应的会话
+func RevokeSessionByRefreshToken(refreshToken string) error {
+	result := db.DB.Table(consts.SessionTable).
+		Where("refresh_token_hash = ? AND revoked_at IS NULL", hashRefreshToken(refreshToken)).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// RevokeSubjectSessions 撤销某个用户的全部会话, exceptID 不为 0 时保留该会话
+func RevokeSubjectSessions(subject string, exceptID uint) error {
+	query := db.DB.Table(consts.SessionTable).Where("subject = ? AND revoked_at IS NULL", subject)
+	if exceptID != 0 {
+		query = query.Where("id <> ?", exceptID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+func IsSessionActive(sessionID uint) (bool, error) {
+	if sessionID == 0 {
+		return false, nil
+	}
+
+	session := models.NewSession()
+	result := db.DB.Table(consts.SessionTable).Where("id = ?", sessionID).Limit(1).Find(session)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	TypeSavedSearchMatch = "saved_search_match"
+)
+
+// Notifier 站内通知保存后的外部推送, 可替换为短信、企业微信等实现
+type Notifier interface {
+	Notify(notification *models.Notification) error
+}
+
+// LogNotifier 只打印日志, 未配置 webhook 时使用
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(notification *models.Notification) error {
+	log.Printf("notify user %d: [%s] %s\n", notification.UserID, notification.Type, notification.Title)
+	return nil
+}
+
+// WebhookNotifier 把通知以 JSON POST 到指定地址
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (w *WebhookNotifier) Notify(notification *models.Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var notifier Notifier = LogNotifier{}
+
+// SetNotifier 替换外部推送实现
+func SetNotifier(n Notifier) {
+	notifier = n
+}
+
+// Init 配置了 NOTIFY_WEBHOOK_URL 时使用 webhook 推送
+func Init() {
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		SetNotifier(NewWebhookNotifier(url))
+		log.Println("\033[32mNotify webhook initialized successfully\033[0m")
+	}
+}
+
+// Send 保存站内通知并异步推送, 推送失败只记录日志
+func Send(notification *models.Notification) error {
+	if err := db.DB.Table(consts.NotificationTable).Create(notification).Error; err != nil {
+		return err
+	}
+
+	n := notifier
+	go func() {
+		if err := n.Notify(notification); err != nil {
+			log.Println("failed to push notification: ", err)
+		}
+	}()
+
+	return nil
+}
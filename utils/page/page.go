@@ -0,0 +1,111 @@
+package page
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type Page struct {
+	Page     int
+	PageSize int
+	Sort     string // 白名单中的排序表达式
+	Desc     bool
+}
+
+// Parse 读取 page, page_size, sort, order 参数, page_token 与 page 等价
+// sortKeys 为允许排序的字段白名单, key 为参数值, value 为 SQL 表达式
+func Parse(c *gin.Context, sortKeys map[string]string, defaultSort string) (*Page, error) {
+	p := &Page{
+		Page:     1,
+		PageSize: DefaultPageSize,
+		Desc:     true,
+	}
+
+	pageStr := c.Query("page")
+	if token := c.Query("page_token"); token != "" {
+		pageStr = token
+	}
+	if pageStr != "" {
+		n, err := strconv.Atoi(pageStr)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid page: %s", pageStr)
+		}
+		p.Page = n
+	}
+
+	if sizeStr := c.Query("page_size"); sizeStr != "" {
+		n, err := strconv.Atoi(sizeStr)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return nil, fmt.Errorf("page_size must be in 1-%d", MaxPageSize)
+		}
+		p.PageSize = n
+	}
+
+	sort := c.DefaultQuery("sort", defaultSort)
+	expr, ok := sortKeys[sort]
+	if !ok {
+		keys := make([]string, 0, len(sortKeys))
+		for k := range sortKeys {
+			keys = append(keys, k)
+		}
+		return nil, fmt.Errorf("invalid sort key: %s, only support %s", sort, strings.Join(keys, "/"))
+	}
+	p.Sort = expr
+
+	switch c.DefaultQuery("order", "desc") {
+	case "desc":
+		p.Desc = true
+	case "asc":
+		p.Desc = false
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	return p, nil
+}
+
+func (p *Page) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+func (p *Page) orderClause() string {
+	direction := "ASC"
+	if p.Desc {
+		direction = "DESC"
+	}
+	// 加上 id 保证翻页时顺序稳定
+	return fmt.Sprintf("%s %s, id %s", p.Sort, direction, direction)
+}
+
+// Find 统计总数并查询当前页
+func (p *Page) Find(query *gorm.DB, dest interface{}) (int64, error) {
+	// 指定 Model 以便统计总数时也排除软删除的记录
+	query = query.Model(dest).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	if err := query.Order(p.orderClause()).Offset(p.Offset()).Limit(p.PageSize).Find(dest).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// NextPageToken 没有下一页时返回空字符串
+func (p *Page) NextPageToken(total int64) string {
+	if int64(p.Page*p.PageSize) >= total {
+		return ""
+	}
+	return strconv.Itoa(p.Page + 1)
+}
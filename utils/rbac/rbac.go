@@ -0,0 +1,59 @@
+package rbac
+
+import "github.com/hewo233/house-system-backend/shared/consts"
+
+var viewerPermissions = []string{
+	consts.PermPropertyView,
+	consts.PermCustomerView,
+	consts.PermUserView,
+}
+
+var agentPermissions = append([]string{
+	consts.PermPropertyCreate,
+	consts.PermPropertyUpdate,
+	consts.PermPropertyDelete,
+	consts.PermCustomerCreate,
+}, viewerPermissions...)
+
+var teamLeadPermissions = append([]string{
+	consts.PermPropertyManageAll,
+	consts.PermCustomerViewPhone,
+}, agentPermissions...)
+
+var adminPermissions = append([]string{
+	consts.PermCustomerManage,
+	consts.PermUserManage,
+	consts.PermInviteManage,
+	consts.PermAuditView,
+}, teamLeadPermissions...)
+
+var rolePermissions = map[string][]string{
+	consts.RoleViewer:   viewerPermissions,
+	consts.RoleAgent:    agentPermissions,
+	consts.RoleUser:     agentPermissions,
+	consts.RoleTeamLead: teamLeadPermissions,
+	consts.RoleAdmin:    adminPermissions,
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions 返回所有角色及其权限
+func RolePermissions() map[string][]string {
+	result := make(map[string][]string, len(rolePermissions))
+	for role, permissions := range rolePermissions {
+		result[role] = append([]string{}, permissions...)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// 富文本片段的长度
+const snippetRunes = 80
+
+// Highlight 用 <em> 标出命中的词, 其余内容做 HTML 转义
+// width 为 0 时返回全文, 否则截取第一个命中位置附近的片段, 没有命中时返回空字符串
+func Highlight(text string, words []string, width int) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// 大小写转换改变了长度时按原文匹配
+		lower = runes
+	}
+
+	mask := make([]bool, len(runes))
+	first := -1
+	for _, word := range words {
+		w := []rune(word)
+		if len(w) == 0 {
+			continue
+		}
+		for i := 0; i+len(w) <= len(lower); i++ {
+			if string(lower[i:i+len(w)]) != word {
+				continue
+			}
+			for j := i; j < i+len(w); j++ {
+				mask[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start, end := 0, len(runes)
+	if width > 0 {
+		if first == -1 {
+			return ""
+		}
+		start = first - width/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + width
+		if end > len(runes) {
+			end = len(runes)
+		}
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && mask[j] == mask[i] {
+			j++
+		}
+		part := html.EscapeString(collapseSpace(string(runes[i:j])))
+		if mask[i] {
+			sb.WriteString("<em>" + part + "</em>")
+		} else {
+			sb.WriteString(part)
+		}
+		i = j
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+
+	return sb.String()
+}
+
+func collapseSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,42 @@
+package search
+
+import (
+	"golang.org/x/net/html"
+	"io"
+	"strings"
+)
+
+// HTMLText 提取 HTML 中的可见文本, 忽略 script 和 style
+func HTMLText(r io.Reader) (string, error) {
+	tokenizer := html.NewTokenizer(r)
+	var sb strings.Builder
+	skip := 0
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return strings.TrimSpace(sb.String()), nil
+			}
+			return "", tokenizer.Err()
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if tag := string(name); tag == "script" || tag == "style" {
+				skip++
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if tag := string(name); (tag == "script" || tag == "style") && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				text := strings.TrimSpace(string(tokenizer.Text()))
+				if text != "" {
+					sb.WriteString(text)
+					sb.WriteByte(' ')
+				}
+			}
+		}
+	}
+}
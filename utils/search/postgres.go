@@ -0,0 +1,176 @@
+package search
+
+import (
+	"fmt"
+	"github.com/hewo233/house-system-backend/db"
+	"github.com/hewo233/house-system-backend/models"
+	"github.com/hewo233/house-system-backend/shared/consts"
+	"gorm.io/gorm/clause"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// tsvector 中位置的上限
+	maxPosition = 16383
+	// 富文本只索引前面这部分内容
+	maxContentRunes = 10000
+)
+
+// PostgresSearcher 分词在 Go 中完成, 直接写入 tsvector 和 tsquery, 不依赖数据库的中文分词插件
+// 地址另外建立 pg_trgm 索引, 用于容错匹配
+type PostgresSearcher struct{}
+
+func NewPostgresSearcher() *PostgresSearcher {
+	for _, sql := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_tsv ON %s USING GIN (tsv)", consts.PropertySearchDocTable, consts.PropertySearchDocTable),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_address_trgm ON %s USING GIN (address gin_trgm_ops)", consts.PropertySearchDocTable, consts.PropertySearchDocTable),
+	} {
+		if err := db.DB.Exec(sql).Error; err != nil {
+			log.Fatal("failed to init search index: ", err)
+		}
+	}
+	log.Println("\033[32mSearch index initialized successfully\033[0m")
+	return &PostgresSearcher{}
+}
+
+type weightedTokens struct {
+	tokens []string
+	weight byte
+}
+
+// buildTSVector 生成 tsvector 字面量, 如 'a':1A 'b':2A 'c':3C
+func buildTSVector(fields ...weightedTokens) string {
+	var sb strings.Builder
+	position := 0
+	for _, field := range fields {
+		for _, token := range field.tokens {
+			if position < maxPosition {
+				position++
+			}
+			if sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%s:%d%c", quoteLexeme(token), position, field.weight)
+		}
+	}
+	return sb.String()
+}
+
+// buildTSQuery 所有词都需要命中, 如 'ab' & 'bc' & 'wk':*
+func buildTSQuery(terms []queryTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		part := quoteLexeme(term.text)
+		if term.prefix {
+			part += ":*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " & ")
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func (s *PostgresSearcher) Index(doc *Document) error {
+	content := ""
+	if doc.Content != nil {
+		content = truncateRunes(*doc.Content, maxContentRunes)
+	} else {
+		var existing models.PropertySearchDoc
+		result := db.DB.Table(consts.PropertySearchDocTable).Select("content").Where("property_id = ?", doc.PropertyID).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+		content = existing.Content
+	}
+
+	tsv := buildTSVector(
+		weightedTokens{tokens: IndexTokens(doc.Address, true), weight: 'A'},
+		weightedTokens{tokens: IndexTokens(doc.District, true), weight: 'B'},
+		weightedTokens{tokens: IndexTokens(content, false), weight: 'C'},
+	)
+
+	return db.DB.Table(consts.PropertySearchDocTable).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "property_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"address", "district", "content", "tsv", "updated_at"}),
+	}).Create(map[string]interface{}{
+		"property_id": doc.PropertyID,
+		"address":     doc.Address,
+		"district":    doc.District,
+		"content":     content,
+		"tsv":         clause.Expr{SQL: "?::tsvector", Vars: []interface{}{tsv}},
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+func (s *PostgresSearcher) Remove(propertyID uint) error {
+	return db.DB.Table(consts.PropertySearchDocTable).Where("property_id = ?", propertyID).Delete(&models.PropertySearchDoc{}).Error
+}
+
+func (s *PostgresSearcher) Search(query string, opts Options) ([]Hit, int64, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return []Hit{}, 0, nil
+	}
+	tsquery := buildTSQuery(terms)
+	raw := strings.ToLower(strings.TrimSpace(query))
+
+	// 全文索引命中, 或者地址与查询足够相似
+	properties := db.DB.Table(consts.PropertyTable).Select("id").Where("deleted_at IS NULL")
+	if len(opts.Statuses) > 0 {
+		properties = properties.Where("status IN ?", opts.Statuses)
+	}
+	where := "property_id IN (?) AND (tsv @@ ?::tsquery OR ? <% address)"
+
+	var total int64
+	if err := db.DB.Table(consts.PropertySearchDocTable).Where(where, properties, tsquery, raw).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "score DESC, property_id DESC"
+	if opts.Asc {
+		order = "score ASC, property_id ASC"
+	}
+
+	var rows []struct {
+		PropertyID uint
+		Address    string
+		Content    string
+		Score      float64
+	}
+	err := db.DB.Table(consts.PropertySearchDocTable).
+		Select("property_id, address, content, ts_rank_cd(tsv, ?::tsquery) + word_similarity(?, address) AS score", tsquery, raw).
+		Where(where, properties, tsquery, raw).
+		Order(order).
+		Offset(opts.Offset).Limit(opts.Limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	words := make([]string, 0, len(terms))
+	for _, term := range terms {
+		words = append(words, term.text)
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, Hit{
+			PropertyID: row.PropertyID,
+			Score:      row.Score,
+			Highlight:  Highlight(row.Address, words, 0),
+			Snippet:    Highlight(row.Content, words, snippetRunes),
+		})
+	}
+
+	return hits, total, nil
+}
@@ -0,0 +1,54 @@
+package search
+
+// Document 房源的可搜索内容
+type Document struct {
+	PropertyID uint
+	Address    string
+	District   string  // 省市区名称
+	Content    *string // 富文本纯文本, nil 表示保留已索引的内容
+}
+
+type Hit struct {
+	PropertyID uint    `json:"property_id"`
+	Score      float64 `json:"score"`
+	Highlight  string  `json:"highlight"` // 高亮后的地址
+	Snippet    string  `json:"snippet"`   // 富文本中命中的片段, 没有命中时为空
+}
+
+// Options 搜索的筛选和分页条件
+type Options struct {
+	Statuses []string // 只返回这些状态的房源, 为空时不限
+	Offset   int
+	Limit    int
+	Asc      bool // 默认按相关度从高到低
+}
+
+// Searcher 搜索后端, 目前只有 Postgres 实现
+type Searcher interface {
+	Index(doc *Document) error
+	Remove(propertyID uint) error
+	Search(query string, opts Options) ([]Hit, int64, error)
+}
+
+// DistrictName 根据行政区划编码返回名称, 加载行政区划字典后替换
+var DistrictName = func(code int) string {
+	return ""
+}
+
+var searcher Searcher
+
+func Init() {
+	searcher = NewPostgresSearcher()
+}
+
+func Index(doc *Document) error {
+	return searcher.Index(doc)
+}
+
+func Remove(propertyID uint) error {
+	return searcher.Remove(propertyID)
+}
+
+func Search(query string, opts Options) ([]Hit, int64, error) {
+	return searcher.Search(query, opts)
+}
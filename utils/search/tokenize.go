@@ -0,0 +1,141 @@
+package search
+
+import (
+	"github.com/mozillazg/go-pinyin"
+	"strings"
+	"unicode"
+)
+
+// 只对长度不超过该值的中文片段生成拼音, 富文本不生成拼音
+const maxPinyinRunes = 32
+
+var pinyinArgs = pinyin.NewArgs()
+
+type segment struct {
+	text string
+	han  bool
+}
+
+// segments 把文本切分为连续的汉字片段和字母数字片段, 其余字符作为分隔符
+func segments(text string) []segment {
+	result := make([]segment, 0)
+	var current []rune
+	han := false
+
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, segment{text: string(current), han: han})
+			current = current[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		isHan := unicode.Is(unicode.Han, r)
+		switch {
+		case isHan:
+			if !han {
+				flush()
+			}
+			han = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if han {
+				flush()
+			}
+			han = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return result
+}
+
+// bigrams 中文按相邻两个字切分, 单字时返回本身
+func bigrams(text string) []string {
+	runes := []rune(text)
+	if len(runes) == 1 {
+		return []string{text}
+	}
+	result := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		result = append(result, string(runes[i:i+2]))
+	}
+	return result
+}
+
+// pinyinTokens 返回每个字的拼音、整段全拼和首字母
+func pinyinTokens(text string) []string {
+	syllables := make([]string, 0)
+	for _, s := range pinyin.LazyPinyin(text, pinyinArgs) {
+		if s != "" {
+			syllables = append(syllables, s)
+		}
+	}
+	if len(syllables) == 0 {
+		return nil
+	}
+
+	initials := make([]byte, 0, len(syllables))
+	for _, s := range syllables {
+		initials = append(initials, s[0])
+	}
+
+	result := append([]string{}, syllables...)
+	return append(result, strings.Join(syllables, ""), string(initials))
+}
+
+// IndexTokens 生成索引词: 汉字单字和双字, 字母数字整词, withPinyin 时加上拼音
+func IndexTokens(text string, withPinyin bool) []string {
+	tokens := make([]string, 0)
+	for _, seg := range segments(text) {
+		if !seg.han {
+			tokens = append(tokens, seg.text)
+			continue
+		}
+		for _, r := range seg.text {
+			tokens = append(tokens, string(r))
+		}
+		if len([]rune(seg.text)) > 1 {
+			tokens = append(tokens, bigrams(seg.text)...)
+		}
+		if withPinyin && len([]rune(seg.text)) <= maxPinyinRunes {
+			tokens = append(tokens, pinyinTokens(seg.text)...)
+		}
+	}
+	return tokens
+}
+
+type queryTerm struct {
+	text   string
+	prefix bool
+}
+
+// queryTerms 查询时汉字按双字匹配, 字母数字按前缀匹配以支持拼音和首字母
+func queryTerms(query string) []queryTerm {
+	terms := make([]queryTerm, 0)
+	seen := make(map[string]bool)
+	for _, seg := range segments(query) {
+		if seg.han {
+			for _, gram := range bigrams(seg.text) {
+				if !seen[gram] {
+					seen[gram] = true
+					terms = append(terms, queryTerm{text: gram})
+				}
+			}
+			continue
+		}
+		if !seen[seg.text] {
+			seen[seg.text] = true
+			terms = append(terms, queryTerm{text: seg.text, prefix: true})
+		}
+	}
+	return terms
+}
+
+func quoteLexeme(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}